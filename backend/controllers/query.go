@@ -49,3 +49,81 @@ func (controller *QueryController) FetchQuery(context *gin.Context) {
 
 	context.JSON(http.StatusOK, response)
 }
+
+func (controller *QueryController) FetchLatest(context *gin.Context) {
+
+	var request LatestRequest
+
+	if err := context.ShouldBindJSON(&request); err != nil || len(request.CounterIDs) == 0 {
+
+		context.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+
+		return
+	}
+
+	queryMap := QueryMap{
+
+		RequestID: uint64(uuid.New().ID()),
+
+		QueryRequest: QueryRequest{
+
+			CounterID: request.CounterIDs[0],
+
+			CounterIDs: request.CounterIDs,
+
+			ObjectIDs: request.ObjectIDs,
+
+			Type: "latest",
+		},
+
+		Response: make(chan Response, 1),
+	}
+
+	controller.queryChannel <- queryMap
+
+	response := <-queryMap.Response
+
+	context.JSON(http.StatusOK, response)
+}
+
+func (controller *QueryController) CreateContinuousQuery(context *gin.Context) {
+
+	var continuousQuery ContinuousQuery
+
+	if err := context.ShouldBindJSON(&continuousQuery); err != nil {
+
+		context.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+
+		return
+	}
+
+	controller.sendAdmin(context, AdminCommand{Action: "create_cq", ContinuousQuery: &continuousQuery})
+}
+
+func (controller *QueryController) GetContinuousQueries(context *gin.Context) {
+
+	controller.sendAdmin(context, AdminCommand{Action: "list_cq"})
+}
+
+func (controller *QueryController) DeleteContinuousQuery(context *gin.Context) {
+
+	controller.sendAdmin(context, AdminCommand{Action: "delete_cq", Name: context.Param("name")})
+}
+
+func (controller *QueryController) sendAdmin(context *gin.Context, command AdminCommand) {
+
+	queryMap := QueryMap{
+
+		RequestID: uint64(uuid.New().ID()),
+
+		Admin: &command,
+
+		Response: make(chan Response, 1),
+	}
+
+	controller.queryChannel <- queryMap
+
+	response := <-queryMap.Response
+
+	context.JSON(http.StatusOK, response)
+}
@@ -51,7 +51,9 @@ func main() {
 
 	deviceChannel := make(chan []PollerDevice, GetDeviceBuffer())
 
-	dataChannel := make(chan []byte, GetDataBuffer())
+	dataChannel := make(chan DataBatch, GetDataBuffer())
+
+	ackChannel := make(chan string, 10000) // a full channel drops acks, which only causes retransmissions
 
 	queryChannel := make(chan QueryMap, GetQueryBuffer())
 
@@ -59,7 +61,7 @@ func main() {
 
 	router := InitRoutes(DB, deviceChannel, queryChannel)
 
-	pollingServer, err := NewPollingServer(deviceChannel, dataChannel)
+	pollingServer, err := NewPollingServer(deviceChannel, dataChannel, ackChannel)
 
 	if err != nil {
 
@@ -70,7 +72,7 @@ func main() {
 		return
 	}
 
-	dbServer, err := NewDBServer(dataChannel)
+	dbServer, err := NewDBServer(dataChannel, ackChannel)
 
 	if err != nil {
 
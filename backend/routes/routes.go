@@ -64,6 +64,18 @@ func InitRoutes(db *sqlx.DB, deviceChannel chan []PollerDevice, queryChannel cha
 
 		{
 			query.POST("/", queryCtrl.FetchQuery)
+
+			query.POST("/latest", queryCtrl.FetchLatest)
+		}
+
+		continuousQueries := v1.Group("/continuous-queries")
+
+		{
+			continuousQueries.POST("/", queryCtrl.CreateContinuousQuery)
+
+			continuousQueries.GET("/", queryCtrl.GetContinuousQueries)
+
+			continuousQueries.DELETE("/:name", queryCtrl.DeleteContinuousQuery)
 		}
 
 	}
@@ -0,0 +1,36 @@
+package server
+
+import (
+	. "backend/utils"
+	"fmt"
+	"github.com/pebbe/zmq4"
+)
+
+// connectSocket connects socket to endpoint, through CurveZMQ when the
+// server's public key is set.
+func connectSocket(socket *zmq4.Socket, endpoint string, serverKey string) error {
+
+	if serverKey != "" {
+
+		secretKey := GetCurve().SecretKey
+
+		if secretKey == "" {
+
+			return fmt.Errorf("curve.secretKey is needed to connect to %s", endpoint)
+		}
+
+		publicKey, err := zmq4.AuthCurvePublic(secretKey)
+
+		if err != nil {
+
+			return fmt.Errorf("invalid curve.secretKey: %v", err)
+		}
+
+		if err := socket.ClientAuthCurve(serverKey, publicKey, secretKey); err != nil {
+
+			return fmt.Errorf("failed to set CURVE keys: %v", err)
+		}
+	}
+
+	return socket.Connect(endpoint)
+}
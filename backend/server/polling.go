@@ -7,10 +7,17 @@ import (
 	"github.com/pebbe/zmq4"
 	"github.com/vmihailenco/msgpack/v5"
 	"go.uber.org/zap"
+	"syscall"
+	"time"
 )
 
+const ackInterval = 50 * time.Millisecond // longest an ack waits for the socket
+
+// PollingServer exchanges devices and event batches with the poller. Batches
+// arrive as [batch ID, events] and are acknowledged with [batch ID] once
+// ReportDB has acknowledged them.
 type PollingServer struct {
-	pullSocket *zmq4.Socket
+	dataSocket *zmq4.Socket
 
 	pushSocket *zmq4.Socket
 
@@ -21,7 +28,7 @@ type PollingServer struct {
 	shutdownPush chan bool
 }
 
-func NewPollingServer(deviceChannel chan []PollerDevice, dataChannel chan []byte) (*PollingServer, error) {
+func NewPollingServer(deviceChannel chan []PollerDevice, dataChannel chan DataBatch, ackChannel chan string) (*PollingServer, error) {
 
 	context, err := zmq4.NewContext()
 
@@ -30,40 +37,44 @@ func NewPollingServer(deviceChannel chan []PollerDevice, dataChannel chan []byte
 		return nil, fmt.Errorf("failed to create context: %v", err)
 	}
 
-	pullSocket, err := context.NewSocket(zmq4.PULL)
+	dataSocket, err := context.NewSocket(zmq4.DEALER)
 
 	if err != nil {
 
 		context.Term()
 
-		return nil, fmt.Errorf("failed to create PULL socket: %v", err)
+		return nil, fmt.Errorf("failed to create DEALER socket: %v", err)
 	}
 
-	if err := pullSocket.Connect("tcp://localhost:6001"); err != nil {
+	dataSocket.SetLinger(0)
+
+	dataSocket.SetRcvtimeo(ackInterval) // acks are sent between receives
 
-		pullSocket.Close()
+	if err := connectSocket(dataSocket, GetPollerDataEndpoint(), GetCurve().PollerKey); err != nil {
+
+		dataSocket.Close()
 
 		context.Term()
 
-		return nil, fmt.Errorf("failed to bind PULL socket: %v", err)
+		return nil, fmt.Errorf("failed to connect DEALER socket: %v", err)
 	}
 
 	pushSocket, err := context.NewSocket(zmq4.PUSH)
 
 	if err != nil {
 
-		pullSocket.Close()
+		dataSocket.Close()
 
 		context.Term()
 
 		return nil, fmt.Errorf("failed to create PUSH socket: %v", err)
 	}
 
-	if err := pushSocket.Connect("tcp://localhost:6002"); err != nil {
+	if err := connectSocket(pushSocket, GetPollerDeviceEndpoint(), GetCurve().PollerKey); err != nil {
 
 		pushSocket.Close()
 
-		pullSocket.Close()
+		dataSocket.Close()
 
 		context.Term()
 
@@ -72,7 +83,7 @@ func NewPollingServer(deviceChannel chan []PollerDevice, dataChannel chan []byte
 
 	server := &PollingServer{
 
-		pullSocket: pullSocket,
+		dataSocket: dataSocket,
 
 		pushSocket: pushSocket,
 
@@ -83,14 +94,16 @@ func NewPollingServer(deviceChannel chan []PollerDevice, dataChannel chan []byte
 		shutdownPush: make(chan bool, 1),
 	}
 
-	go server.pollingReceiver(dataChannel)
+	go server.pollingReceiver(dataChannel, ackChannel)
 
 	go server.pollingSender(deviceChannel)
 
 	return server, nil
 }
 
-func (server *PollingServer) pollingReceiver(dataChannel chan []byte) {
+// pollingReceiver relays batches from the poller to dataChannel and the acks
+// of ReportDB from ackChannel back to the poller.
+func (server *PollingServer) pollingReceiver(dataChannel chan DataBatch, ackChannel chan string) {
 
 	for {
 
@@ -98,7 +111,7 @@ func (server *PollingServer) pollingReceiver(dataChannel chan []byte) {
 
 		case <-server.shutdownPull:
 
-			server.pullSocket.Close()
+			server.dataSocket.Close()
 
 			server.shutdownPull <- true
 
@@ -106,16 +119,54 @@ func (server *PollingServer) pollingReceiver(dataChannel chan []byte) {
 
 		default:
 
-			data, err := server.pullSocket.RecvBytes(0)
+			server.sendAcks(ackChannel)
+
+			frames, err := server.dataSocket.RecvMessageBytes(0)
 
 			if err != nil {
 
-				Logger.Warn("pollingReceiver:Error receiving data", zap.Error(err))
+				if zmq4.AsErrno(err) != zmq4.Errno(syscall.EAGAIN) {
+
+					Logger.Warn("pollingReceiver:Error receiving data", zap.Error(err))
+				}
 
 				continue
 			}
 
-			dataChannel <- data
+			switch len(frames) {
+
+			case 1:
+
+				dataChannel <- DataBatch{Data: frames[0]}
+
+			case 2:
+
+				dataChannel <- DataBatch{ID: string(frames[0]), Data: frames[1]}
+
+			default:
+
+				Logger.Warn("pollingReceiver:Invalid message", zap.Int("frames", len(frames)))
+			}
+		}
+	}
+}
+
+func (server *PollingServer) sendAcks(ackChannel chan string) {
+
+	for {
+
+		select {
+
+		case batchID := <-ackChannel:
+
+			if _, err := server.dataSocket.SendMessageDontwait(batchID); err != nil {
+
+				Logger.Warn("pollingReceiver : Error sending ack", zap.String("batch_id", batchID), zap.Error(err))
+			}
+
+		default:
+
+			return
 		}
 	}
 }
@@ -47,7 +47,7 @@ func NewQueryServer(queryChannel chan QueryMap, queryMapping map[uint64]chan Res
 
 	pushSocket.SetLinger(0)
 
-	if err := pushSocket.Connect("tcp://localhost:6004"); err != nil {
+	if err := connectSocket(pushSocket, GetReportDBQueryEndpoint(), GetCurve().ReportDBKey); err != nil {
 
 		pushSocket.Close()
 
@@ -67,7 +67,7 @@ func NewQueryServer(queryChannel chan QueryMap, queryMapping map[uint64]chan Res
 		return nil, fmt.Errorf("failed to create PULL socket: %v", err)
 	}
 
-	if err := pullSocket.Connect("tcp://localhost:6005"); err != nil {
+	if err := connectSocket(pullSocket, GetReportDBResultEndpoint(), GetCurve().ReportDBKey); err != nil {
 
 		pullSocket.Close()
 
@@ -125,6 +125,8 @@ func (server *QueryServer) querySender(queryChannel chan QueryMap) {
 				RequestID: queryMap.RequestID,
 
 				QueryRequest: queryMap.QueryRequest,
+
+				Admin: queryMap.Admin,
 			}
 
 			queryBytes, err := msgpack.Marshal(querySend)
@@ -2,20 +2,27 @@ package server
 
 import (
 	. "backend/logger"
+	. "backend/utils"
 	"fmt"
 	"github.com/pebbe/zmq4"
 	"go.uber.org/zap"
+	"syscall"
+	"time"
 )
 
+// DBServer relays event batches to ReportDB as [batch ID, events] on a DEALER
+// socket, and ReportDB's acks, [batch ID], to ackChannel. It keeps no batch:
+// one ReportDB can't take at once is dropped and the poller sends it again,
+// so a batch without an ID is delivered at most once.
 type DBServer struct {
-	pushSocket *zmq4.Socket
+	dealerSocket *zmq4.Socket
 
 	context *zmq4.Context
 
 	shutdownPush chan bool
 }
 
-func NewDBServer(dataChannel chan []byte) (*DBServer, error) {
+func NewDBServer(dataChannel chan DataBatch, ackChannel chan string) (*DBServer, error) {
 
 	context, err := zmq4.NewContext()
 
@@ -24,41 +31,45 @@ func NewDBServer(dataChannel chan []byte) (*DBServer, error) {
 		return nil, fmt.Errorf("failed to create context: %v", err)
 	}
 
-	pushSocket, err := context.NewSocket(zmq4.PUSH)
+	dealerSocket, err := context.NewSocket(zmq4.DEALER)
 
 	if err != nil {
 
 		context.Term()
 
-		return nil, fmt.Errorf("failed to create PUSH socket: %v", err)
+		return nil, fmt.Errorf("failed to create DEALER socket: %v", err)
 	}
 
-	pushSocket.SetLinger(0)
+	dealerSocket.SetLinger(0)
 
-	if err := pushSocket.Connect("tcp://localhost:6003"); err != nil {
+	if err := connectSocket(dealerSocket, GetReportDBDataEndpoint(), GetCurve().ReportDBKey); err != nil {
 
-		pushSocket.Close()
+		dealerSocket.Close()
 
 		context.Term()
 
-		return nil, fmt.Errorf("failed to bind PUSH socket: %v", err)
+		return nil, fmt.Errorf("failed to connect DEALER socket: %v", err)
 	}
 
 	server := &DBServer{
 
-		pushSocket: pushSocket,
+		dealerSocket: dealerSocket,
 
 		context: context,
 
 		shutdownPush: make(chan bool, 1),
 	}
 
-	go server.dbSender(dataChannel)
+	go server.dbSender(dataChannel, ackChannel)
 
 	return server, nil
 }
 
-func (server *DBServer) dbSender(dataChannel chan []byte) {
+func (server *DBServer) dbSender(dataChannel chan DataBatch, ackChannel chan string) {
+
+	ticker := time.NewTicker(ackInterval)
+
+	defer ticker.Stop()
 
 	for {
 
@@ -66,7 +77,7 @@ func (server *DBServer) dbSender(dataChannel chan []byte) {
 
 		case <-server.shutdownPush:
 
-			server.pushSocket.Close()
+			server.dealerSocket.Close()
 
 			close(dataChannel)
 
@@ -74,19 +85,61 @@ func (server *DBServer) dbSender(dataChannel chan []byte) {
 
 			return
 
-		case data := <-dataChannel:
+		case batch := <-dataChannel:
+
+			parts := []interface{}{batch.Data}
+
+			if batch.ID != "" {
 
-			if _, err := server.pushSocket.SendBytes(data, 0); err != nil {
+				parts = []interface{}{batch.ID, batch.Data}
+			}
+
+			// A batch ReportDB can't take now is dropped, the poller sends it again
+			if _, err := server.dealerSocket.SendMessageDontwait(parts...); err != nil {
 
-				Logger.Warn("dbSender : Error sending data", zap.Error(err))
+				Logger.Warn("dbSender : Error sending data", zap.String("batch_id", batch.ID), zap.Error(err))
 
 				continue
 			}
+
+		case <-ticker.C:
+
+			server.receiveAcks(ackChannel)
 		}
 	}
 
 }
 
+func (server *DBServer) receiveAcks(ackChannel chan string) {
+
+	for {
+
+		frames, err := server.dealerSocket.RecvMessage(zmq4.DONTWAIT)
+
+		if err != nil {
+
+			if zmq4.AsErrno(err) != zmq4.Errno(syscall.EAGAIN) {
+
+				Logger.Warn("dbSender : Error receiving ack", zap.Error(err))
+			}
+
+			return
+		}
+
+		if len(frames) != 1 {
+
+			continue
+		}
+
+		select {
+
+		case ackChannel <- frames[0]:
+
+		default: // the poller sends the batch again and gets the ack then
+		}
+	}
+}
+
 func (server *DBServer) Shutdown() {
 
 	server.shutdownPush <- true
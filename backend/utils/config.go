@@ -24,6 +24,28 @@ type Configuration struct {
 	DbName string `json:"dbName"`
 
 	DbSSLMode string `json:"dbSSLMode"`
+
+	PollerDataEndpoint string `json:"pollerDataEndpoint"`
+
+	PollerDeviceEndpoint string `json:"pollerDeviceEndpoint"`
+
+	ReportDBDataEndpoint string `json:"reportdbDataEndpoint"`
+
+	ReportDBQueryEndpoint string `json:"reportdbQueryEndpoint"`
+
+	ReportDBResultEndpoint string `json:"reportdbResultEndpoint"`
+
+	Curve CurveConfig `json:"curve"`
+}
+
+// CurveConfig connects to the poller and ReportDB through CurveZMQ when
+// their public keys are set, with the backend's SecretKey.
+type CurveConfig struct {
+	SecretKey string `json:"secretKey"`
+
+	PollerKey string `json:"pollerKey"`
+
+	ReportDBKey string `json:"reportdbKey"`
 }
 
 var config Configuration
@@ -39,6 +61,19 @@ func InitConfig() error {
 
 	configPath := currentPath + "/config/config.json"
 
+	config = Configuration{ // endpoints missing from config.json keep the default ports
+
+		PollerDataEndpoint: "tcp://localhost:6001",
+
+		PollerDeviceEndpoint: "tcp://localhost:6002",
+
+		ReportDBDataEndpoint: "tcp://localhost:6003",
+
+		ReportDBQueryEndpoint: "tcp://localhost:6004",
+
+		ReportDBResultEndpoint: "tcp://localhost:6005",
+	}
+
 	configData, err := os.ReadFile(configPath)
 
 	if err != nil {
@@ -98,3 +133,33 @@ func GetDBSSLMode() string {
 
 	return config.DbSSLMode
 }
+
+func GetPollerDataEndpoint() string {
+
+	return config.PollerDataEndpoint
+}
+
+func GetPollerDeviceEndpoint() string {
+
+	return config.PollerDeviceEndpoint
+}
+
+func GetReportDBDataEndpoint() string {
+
+	return config.ReportDBDataEndpoint
+}
+
+func GetReportDBQueryEndpoint() string {
+
+	return config.ReportDBQueryEndpoint
+}
+
+func GetReportDBResultEndpoint() string {
+
+	return config.ReportDBResultEndpoint
+}
+
+func GetCurve() CurveConfig {
+
+	return config.Curve
+}
@@ -13,3 +13,11 @@ type PollerDevice struct {
 
 	Port uint16 `msgpack:"port" json:"port"`
 }
+
+// DataBatch is an event batch relayed from the poller to ReportDB. ID is
+// empty for batches sent without acknowledgement.
+type DataBatch struct {
+	ID string
+
+	Data []byte
+}
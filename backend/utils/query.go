@@ -1,19 +1,168 @@
 package utils
 
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
 type QueryRequest struct {
 	CounterID uint16 `msgpack:"counter_id" json:"counter_id" binding:"required"`
 
+	CounterIDs []uint16 `msgpack:"counter_ids" json:"counter_ids,omitempty"`
+
 	ObjectIDs []uint32 `msgpack:"object_ids" json:"object_ids,omitempty"`
 
 	From uint32 `msgpack:"from" json:"from" binding:"required"`
 
 	To uint32 `msgpack:"to" json:"to" binding:"required"`
 
-	Aggregation string `msgpack:"aggregation" json:"aggregation,omitempty" binding:"required"`
+	Aggregation AggregationList `msgpack:"aggregation" json:"aggregation,omitempty" binding:"required"`
 
 	GroupByObjects bool `msgpack:"group_by_objects" json:"group_by_objects,omitempty"`
 
 	Interval int `msgpack:"interval" json:"interval,omitempty"`
+
+	Fill string `msgpack:"fill" json:"fill,omitempty"`
+
+	MergeEmpty bool `msgpack:"merge_empty" json:"merge_empty,omitempty"`
+
+	CalendarInterval string `msgpack:"calendar_interval" json:"calendar_interval,omitempty"`
+
+	Timezone string `msgpack:"timezone" json:"timezone,omitempty"`
+
+	Explain bool `msgpack:"explain" json:"explain,omitempty"`
+
+	Priority string `msgpack:"priority" json:"priority,omitempty"`
+
+	Type string `msgpack:"type" json:"type,omitempty"`
+
+	Format string `msgpack:"format" json:"format,omitempty"`
+
+	Limit int `msgpack:"limit" json:"limit,omitempty"`
+
+	Offset int `msgpack:"offset" json:"offset,omitempty"`
+
+	MaxPoints int `msgpack:"max_points" json:"max_points,omitempty"`
+
+	Downsample string `msgpack:"downsample" json:"downsample,omitempty"`
+
+	Baseline *BaselineOptions `msgpack:"baseline,omitempty" json:"baseline,omitempty"`
+
+	Forecast *ForecastOptions `msgpack:"forecast,omitempty" json:"forecast,omitempty"`
+
+	Heatmap *HeatmapOptions `msgpack:"heatmap,omitempty" json:"heatmap,omitempty"`
+
+	Window *WindowOptions `msgpack:"window,omitempty" json:"window,omitempty"`
+
+	Offsets []int `msgpack:"offsets,omitempty" json:"offsets,omitempty"`
+}
+
+// AggregationList is one aggregation or a comma separated list of them. JSON
+// requests may also send the list as an array, ReportDB always gets a string.
+type AggregationList string
+
+func (list *AggregationList) UnmarshalJSON(data []byte) error {
+
+	var names []string
+
+	if err := json.Unmarshal(data, &names); err == nil {
+
+		*list = AggregationList(strings.Join(names, ","))
+
+		return nil
+	}
+
+	var name string
+
+	if err := json.Unmarshal(data, &name); err != nil {
+
+		return fmt.Errorf("aggregation must be a string or an array of strings")
+	}
+
+	*list = AggregationList(name)
+
+	return nil
+}
+
+type BaselineOptions struct {
+	Method string `msgpack:"method" json:"method,omitempty"`
+
+	K float64 `msgpack:"k" json:"k,omitempty"`
+
+	Window int `msgpack:"window" json:"window,omitempty"`
+
+	Season int `msgpack:"season" json:"season,omitempty"`
+
+	Seasons int `msgpack:"seasons" json:"seasons,omitempty"`
+}
+
+type ForecastOptions struct {
+	Model string `msgpack:"model" json:"model,omitempty"`
+
+	Lookback int `msgpack:"lookback" json:"lookback,omitempty"`
+
+	Horizon int `msgpack:"horizon" json:"horizon,omitempty"`
+
+	Threshold *float64 `msgpack:"threshold,omitempty" json:"threshold,omitempty"`
+
+	Season int `msgpack:"season" json:"season,omitempty"`
+
+	Alpha float64 `msgpack:"alpha" json:"alpha,omitempty"`
+
+	Beta float64 `msgpack:"beta" json:"beta,omitempty"`
+
+	Gamma float64 `msgpack:"gamma" json:"gamma,omitempty"`
+}
+
+type HeatmapOptions struct {
+	Scale string `msgpack:"scale" json:"scale,omitempty"`
+
+	Bins int `msgpack:"bins" json:"bins,omitempty"`
+
+	Min float64 `msgpack:"min" json:"min,omitempty"`
+
+	Max float64 `msgpack:"max" json:"max,omitempty"`
+}
+
+type WindowOptions struct {
+	Function string `msgpack:"function" json:"function"`
+
+	Size int `msgpack:"size" json:"size,omitempty"`
+
+	Alpha float64 `msgpack:"alpha" json:"alpha,omitempty"`
+}
+
+// LatestRequest asks for the last known value of every counter of the objects,
+// of every object when ObjectIDs is empty.
+type LatestRequest struct {
+	CounterIDs []uint16 `json:"counter_ids" binding:"required"`
+
+	ObjectIDs []uint32 `json:"object_ids,omitempty"`
+}
+
+type AdminCommand struct {
+	Action string `msgpack:"action" json:"action"`
+
+	ContinuousQuery *ContinuousQuery `msgpack:"continuous_query,omitempty" json:"continuous_query,omitempty"`
+
+	Name string `msgpack:"name,omitempty" json:"name,omitempty"`
+}
+
+type ContinuousQuery struct {
+	Name string `msgpack:"name" json:"name" binding:"required"`
+
+	Query QueryRequest `msgpack:"query" json:"query" binding:"-"` // from and to are set by reportdb for every window
+
+	Every int `msgpack:"every" json:"every" binding:"required"`
+
+	Delay int `msgpack:"delay" json:"delay,omitempty"`
+
+	TargetCounterID uint16 `msgpack:"target_counter_id" json:"target_counter_id" binding:"required"`
+
+	TargetObjectID uint32 `msgpack:"target_object_id" json:"target_object_id,omitempty"`
+
+	LastRun uint32 `msgpack:"last_run" json:"last_run,omitempty"`
 }
 
 type QueryMap struct {
@@ -21,6 +170,8 @@ type QueryMap struct {
 
 	QueryRequest QueryRequest `json:"query_request"`
 
+	Admin *AdminCommand `json:"admin,omitempty"`
+
 	Response chan Response
 }
 
@@ -28,6 +179,8 @@ type QuerySend struct {
 	RequestID uint64 `msgpack:"request_id" json:"request_id"`
 
 	QueryRequest QueryRequest `msgpack:"query_request" json:"query_request"`
+
+	Admin *AdminCommand `msgpack:"admin,omitempty" json:"admin,omitempty"`
 }
 
 type Response struct {
@@ -35,7 +188,11 @@ type Response struct {
 
 	Error string `msgpack:"error,omitempty" json:"error,omitempty"`
 
+	Code string `msgpack:"code,omitempty" json:"code,omitempty"`
+
 	Data interface{} `msgpack:"data" json:"data"`
+
+	Stats interface{} `msgpack:"stats,omitempty" json:"stats,omitempty"`
 }
 
 type DataPoint struct {
@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestAggregationList(t *testing.T) {
+
+	tests := []struct {
+		body string
+
+		want AggregationList
+
+		fails bool
+	}{
+		{body: `{"aggregation": "avg"}`, want: "avg"},
+
+		{body: `{"aggregation": "min,avg,max"}`, want: "min,avg,max"},
+
+		{body: `{"aggregation": ["min", "avg", "max"]}`, want: "min,avg,max"},
+
+		{body: `{"aggregation": []}`, want: ""},
+
+		{body: `{"aggregation": 5}`, fails: true},
+
+		{body: `{"aggregation": ["avg", 5]}`, fails: true},
+	}
+
+	for _, test := range tests {
+
+		var request QueryRequest
+
+		err := json.Unmarshal([]byte(test.body), &request)
+
+		if test.fails {
+
+			if err == nil {
+
+				t.Errorf("%s: no error, got aggregation %q", test.body, request.Aggregation)
+			}
+
+			continue
+		}
+
+		if err != nil || request.Aggregation != test.want {
+
+			t.Errorf("%s: aggregation = %q, %v, want %q", test.body, request.Aggregation, err, test.want)
+		}
+	}
+}
@@ -7,18 +7,41 @@ import (
 	"go.uber.org/zap"
 	. "poller/logger"
 	. "poller/utils"
+	"strconv"
+	"syscall"
+	"time"
 )
 
+const ackInterval = 50 * time.Millisecond // how often acks are read and retransmissions checked
+
+// PollingServer receives devices to poll and sends the polled events. Event
+// batches are sent as [batch ID, events] on a DEALER socket and kept until
+// ReportDB acknowledges them with [batch ID] through the backend, so a batch
+// lost on the way is sent again.
 type PollingServer struct {
 	pullSocket *zmq4.Socket
 
-	pushSocket *zmq4.Socket
+	dataSocket *zmq4.Socket
 
 	context *zmq4.Context
 
 	shutdownPull chan bool
 
 	shutdownPush chan bool
+
+	session string // keeps batch IDs apart across restarts
+
+	sequence uint64
+
+	unacked map[string]*unackedBatch
+
+	order []string // unacked batch IDs, oldest first, some already acknowledged
+}
+
+type unackedBatch struct {
+	data []byte
+
+	sent time.Time
 }
 
 func NewPollingServer(deviceChannel chan []Device, dataChannel chan []Events) (*PollingServer, error) {
@@ -30,6 +53,13 @@ func NewPollingServer(deviceChannel chan []Device, dataChannel chan []Events) (*
 		return nil, fmt.Errorf("failed to create context: %v", err)
 	}
 
+	if err := startAuthenticator(context); err != nil {
+
+		context.Term()
+
+		return nil, err
+	}
+
 	pullSocket, err := context.NewSocket(zmq4.PULL)
 
 	if err != nil {
@@ -39,7 +69,7 @@ func NewPollingServer(deviceChannel chan []Device, dataChannel chan []Events) (*
 		return nil, fmt.Errorf("failed to create PULL socket: %v", err)
 	}
 
-	if err := pullSocket.Bind("tcp://*:6002"); err != nil {
+	if err := bindSocket(pullSocket, GetDeviceEndpoint()); err != nil {
 
 		pullSocket.Close()
 
@@ -48,7 +78,7 @@ func NewPollingServer(deviceChannel chan []Device, dataChannel chan []Events) (*
 		return nil, fmt.Errorf("failed to bind PULL socket: %v", err)
 	}
 
-	pushSocket, err := context.NewSocket(zmq4.PUSH)
+	dataSocket, err := context.NewSocket(zmq4.DEALER)
 
 	if err != nil {
 
@@ -56,33 +86,37 @@ func NewPollingServer(deviceChannel chan []Device, dataChannel chan []Events) (*
 
 		context.Term()
 
-		return nil, fmt.Errorf("failed to create PUB socket: %v", err)
+		return nil, fmt.Errorf("failed to create DEALER socket: %v", err)
 	}
 
-	pushSocket.SetLinger(0)
+	dataSocket.SetLinger(0) // unacknowledged batches are sent again anyway
 
-	if err := pushSocket.Bind("tcp://*:6001"); err != nil {
+	if err := bindSocket(dataSocket, GetDataEndpoint()); err != nil {
 
-		pushSocket.Close()
+		dataSocket.Close()
 
 		pullSocket.Close()
 
 		context.Term()
 
-		return nil, fmt.Errorf("failed to bind PUB socket: %v", err)
+		return nil, fmt.Errorf("failed to bind DEALER socket: %v", err)
 	}
 
 	server := &PollingServer{
 
 		pullSocket: pullSocket,
 
-		pushSocket: pushSocket,
+		dataSocket: dataSocket,
 
 		context: context,
 
 		shutdownPull: make(chan bool, 1),
 
 		shutdownPush: make(chan bool, 1),
+
+		session: strconv.FormatInt(time.Now().UnixNano(), 36),
+
+		unacked: make(map[string]*unackedBatch),
 	}
 
 	go server.pollingReceiver(deviceChannel)
@@ -135,13 +169,22 @@ func (server *PollingServer) pollingReceiver(deviceChannel chan []Device) {
 
 func (server *PollingServer) pollingSender(dataChannel chan []Events) {
 
+	ticker := time.NewTicker(ackInterval)
+
+	defer ticker.Stop()
+
 	for {
 
 		select {
 
 		case <-server.shutdownPush:
 
-			server.pushSocket.Close()
+			if len(server.unacked) > 0 {
+
+				Logger.Warn("pollingSender: Unacknowledged batches dropped", zap.Int("batches", len(server.unacked)))
+			}
+
+			server.dataSocket.Close()
 
 			close(dataChannel)
 
@@ -162,17 +205,114 @@ func (server *PollingServer) pollingSender(dataChannel chan []Events) {
 				continue
 			}
 
-			if _, err = server.pushSocket.SendBytes(data, 0); err != nil {
+			server.sequence++
 
-				Logger.Error("pollingSender: Error sending response", zap.Error(err))
+			batchID := server.session + "-" + strconv.FormatUint(server.sequence, 10)
 
-				continue
+			server.keepUnacked(batchID, data)
+
+			server.sendBatch(batchID, server.unacked[batchID])
+
+		case <-ticker.C:
+
+			server.receiveAcks()
+
+			server.retransmit()
+		}
+	}
+}
+
+// sendBatch sends a batch without waiting, so a backend that is down doesn't
+// block polling. A batch that couldn't be sent is retransmitted later.
+func (server *PollingServer) sendBatch(batchID string, batch *unackedBatch) {
+
+	batch.sent = time.Now()
+
+	if _, err := server.dataSocket.SendMessageDontwait(batchID, batch.data); err != nil && zmq4.AsErrno(err) != zmq4.Errno(syscall.EAGAIN) {
+
+		Logger.Error("pollingSender: Error sending response", zap.String("batch_id", batchID), zap.Error(err))
+	}
+}
+
+// keepUnacked keeps a batch until it is acknowledged, dropping the oldest
+// one past GetMaxUnacked.
+func (server *PollingServer) keepUnacked(batchID string, data []byte) {
+
+	for len(server.unacked) >= GetMaxUnacked() && len(server.order) > 0 {
+
+		oldest := server.order[0]
+
+		server.order = server.order[1:]
+
+		if _, exists := server.unacked[oldest]; exists {
+
+			delete(server.unacked, oldest)
+
+			Logger.Warn("pollingSender: Too many unacknowledged batches, dropped the oldest", zap.String("batch_id", oldest))
+		}
+	}
+
+	server.unacked[batchID] = &unackedBatch{data: data}
+
+	server.order = append(server.order, batchID)
+}
+
+func (server *PollingServer) receiveAcks() {
+
+	for {
+
+		frames, err := server.dataSocket.RecvMessage(zmq4.DONTWAIT)
+
+		if err != nil {
+
+			if zmq4.AsErrno(err) != zmq4.Errno(syscall.EAGAIN) {
+
+				Logger.Warn("pollingSender: Error receiving ack", zap.Error(err))
 			}
 
+			return
+		}
+
+		if len(frames) == 1 {
+
+			delete(server.unacked, frames[0])
 		}
 	}
 }
 
+// retransmit sends again the batches unacknowledged for GetAckTimeout, and
+// forgets acknowledged ones at the front of the order.
+func (server *PollingServer) retransmit() {
+
+	timeout := time.Duration(GetAckTimeout()) * time.Millisecond
+
+	now := time.Now()
+
+	front := 0 // acknowledged batches before the oldest unacknowledged one
+
+	for i, batchID := range server.order {
+
+		batch, exists := server.unacked[batchID]
+
+		if !exists {
+
+			if front == i {
+
+				front++
+			}
+
+			continue
+		}
+
+		if now.Sub(batch.sent) >= timeout {
+
+			server.sendBatch(batchID, batch)
+		}
+	}
+
+	server.order = server.order[front:]
+}
+
 func (server *PollingServer) Shutdown() {
 
 	server.shutdownPull <- true
@@ -20,6 +20,25 @@ type Configuration struct {
 	PollDeviceBuffer int `json:"pollDeviceBuffer"`
 
 	WorkBuffer int `json:"workBuffer"`
+
+	DeviceEndpoint string `json:"deviceEndpoint"`
+
+	DataEndpoint string `json:"dataEndpoint"`
+
+	AckTimeout int `json:"ackTimeout"`
+
+	MaxUnacked int `json:"maxUnacked"`
+
+	Curve CurveConfig `json:"curve"`
+}
+
+// CurveConfig enables CurveZMQ on both sockets when SecretKey is set. Only
+// clients whose public key is in AuthorizedKeys may connect, any client with
+// "*".
+type CurveConfig struct {
+	SecretKey string `json:"secretKey"`
+
+	AuthorizedKeys []string `json:"authorizedKeys"`
 }
 
 var config Configuration
@@ -57,6 +76,17 @@ func InitConfig() error {
 
 	configPath := currentPath + "/config/config.json"
 
+	config = Configuration{ // endpoints missing from config.json keep the default ports
+
+		DeviceEndpoint: "tcp://*:6002",
+
+		DataEndpoint: "tcp://*:6001",
+
+		AckTimeout: 5000,
+
+		MaxUnacked: 10000,
+	}
+
 	configData, err := os.ReadFile(configPath)
 
 	if err != nil {
@@ -143,6 +173,35 @@ func GetBatchInterval() int {
 	return config.BatchInterval
 }
 
+func GetDeviceEndpoint() string {
+
+	return config.DeviceEndpoint
+}
+
+func GetDataEndpoint() string {
+
+	return config.DataEndpoint
+}
+
+// GetAckTimeout returns after how many milliseconds a batch ReportDB hasn't
+// acknowledged is sent again.
+func GetAckTimeout() int {
+
+	return config.AckTimeout
+}
+
+// GetMaxUnacked returns how many unacknowledged batches are kept for
+// retransmission before the oldest is dropped.
+func GetMaxUnacked() int {
+
+	return config.MaxUnacked
+}
+
+func GetCurve() CurveConfig {
+
+	return config.Curve
+}
+
 func GetCounterType(counterId uint16) DataType {
 
 	return counterMapping[counterId]
@@ -10,8 +10,11 @@ import (
 	"os"
 	"os/signal"
 	. "reportdb/cache"
+	. "reportdb/datastore/continuous"
+	. "reportdb/datastore/feed"
 	. "reportdb/datastore/reader"
 	. "reportdb/datastore/writer"
+	. "reportdb/ingest"
 	. "reportdb/logger"
 	. "reportdb/server"
 	. "reportdb/storage"
@@ -19,10 +22,23 @@ import (
 	"runtime"
 	"syscall"
 	"time"
+	_ "time/tzdata"
 )
 
 func main() {
 
+	if handled, err := runCommand(os.Args[1:]); handled {
+
+		if err != nil {
+
+			fmt.Println(err)
+
+			os.Exit(1)
+		}
+
+		return
+	}
+
 	go func() {
 
 		http.ListenAndServe("localhost:6060", nil)
@@ -84,7 +100,9 @@ func main() {
 
 	dataChannel := make(chan []Events, GetDataBuffer())
 
-	pollingServer, err := NewPollingServer(dataChannel)
+	batchChannel := make(chan Batch, GetDataBuffer())
+
+	pollingServer, err := NewPollingServer(dataChannel, batchChannel)
 
 	if err != nil {
 
@@ -95,7 +113,23 @@ func main() {
 
 	storePool := NewStorePool()
 
-	writers, err := StartWriter(storePool)
+	if err := storePool.LoadRegistry(); err != nil {
+
+		Logger.Error("Error loading object registry", zap.Error(err))
+
+		return
+	}
+
+	if err := storePool.LoadLatest(); err != nil {
+
+		Logger.Error("Error loading latest values", zap.Error(err))
+
+		return
+	}
+
+	feed := NewFeed()
+
+	writers, err := StartWriter(storePool, feed)
 
 	if err != nil {
 
@@ -104,22 +138,33 @@ func main() {
 		return
 	}
 
-	DistributeData(dataChannel, writers)
-
-	responseChannel := make(chan Response, GetResponseBuffer())
+	DistributeData(dataChannel, batchChannel, writers)
 
-	readers, err := StartReaders(storePool, responseChannel)
+	feedServer, err := NewFeedServer(feed)
 
 	if err != nil {
 
-		Logger.Error("Error starting readers", zap.Error(err))
+		Logger.Error("Failed to start feedServer", zap.Error(err))
 
 		return
 	}
 
+	responseChannel := make(chan Response, GetResponseBuffer())
+
+	executor := StartExecutor(storePool, responseChannel)
+
 	queryChannel := make(chan QueryReceive, GetQueryBuffer())
 
-	queryServer, err := NewQueryServer(queryChannel, responseChannel)
+	continuousQueries := NewContinuousQueries(queryChannel, dataChannel)
+
+	if err := continuousQueries.Load(); err != nil {
+
+		Logger.Error("Error loading continuous queries", zap.Error(err))
+
+		return
+	}
+
+	queryServer, err := NewQueryServer(queryChannel, responseChannel, continuousQueries.HandleAdmin)
 
 	if err != nil {
 
@@ -128,7 +173,25 @@ func main() {
 		return
 	}
 
-	DistributeQuery(queryChannel, readers)
+	DistributeQuery(queryChannel, executor)
+
+	httpServer, err := NewHTTPServer(GetHTTPAddress(), dataChannel, queryChannel, continuousQueries.HandleAdmin)
+
+	if err != nil {
+
+		Logger.Error("Failed to start httpServer", zap.Error(err))
+
+		return
+	}
+
+	ingest, err := StartIngest(dataChannel)
+
+	if err != nil {
+
+		Logger.Error("Failed to start ingest", zap.Error(err))
+
+		return
+	}
 
 	err = storePool.SaveEngine()
 
@@ -143,8 +206,16 @@ func main() {
 
 	Logger.Info("Start shutting down", zap.Time("time", time.Now()))
 
+	httpServer.Shutdown()
+
+	ingest.Shutdown()
+
+	continuousQueries.Shutdown()
+
 	pollingServer.Shutdown()
 
+	feedServer.Shutdown()
+
 	queryServer.Shutdown()
 
 	storePool.Shutdown()
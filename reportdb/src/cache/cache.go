@@ -3,20 +3,54 @@ package cache
 import (
 	"fmt"
 	"github.com/dgraph-io/ristretto/v2"
+	"hash/fnv"
 	. "reportdb/utils"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
-var globalCache *ristretto.Cache[string, []DataPoint]
+const (
+	seriesTTL = time.Hour
+
+	pointCost = 12 // a timestamp and a numeric value
+
+	stringCost = 4 + 16 // a timestamp and a string header
+
+	keyLocks = 256
+)
+
+// Series holds every decoded point of one object for one day of one counter,
+// in write order. Writers append to it, so readers must go through AppendRange.
+type Series struct {
+	lock sync.RWMutex
+
+	columns Columns
+
+	cost int64
+}
+
+var (
+	globalCache *ristretto.Cache[string, *Series]
+
+	// loads and write-throughs of the same key are serialized, so a point is
+	// either in the loaded series or appended to it, never lost or doubled
+	globalKeyLocks [keyLocks]sync.Mutex
+
+	// counted here rather than by ristretto, whose metrics would also count
+	// the lookups of every write-through
+	hits, misses atomic.Uint64
+)
 
 func InitCache() error {
 
 	var err error
 
-	globalCache, err = ristretto.NewCache(&ristretto.Config[string, []DataPoint]{
-		NumCounters: 5000,
-		MaxCost:     1 << 30, // 1GB max cache size
+	globalCache, err = ristretto.NewCache(&ristretto.Config[string, *Series]{
+		NumCounters: 1_000_000,
+		MaxCost:     1 << 30, // 1GB of decoded points
 		BufferItems: 64,      // Number of keys per Get buffer
-		Metrics:     true,
 	})
 
 	if err != nil {
@@ -27,23 +61,206 @@ func InitCache() error {
 	return nil
 }
 
-func GetCache() *ristretto.Cache[string, []DataPoint] {
+func GetCacheKey(path string, objectID uint32) string {
+
+	return path + "_" + strconv.FormatUint(uint64(objectID), 10)
+}
+
+// LoadSeries returns the cached series of an object for the day at path, or
+// decodes the whole day through loader and caches it. The bool reports a hit.
+func LoadSeries(path string, objectID uint32, loader func() (Columns, error)) (*Series, bool, error) {
+
+	key := GetCacheKey(path, objectID)
+
+	if series, found := globalCache.Get(key); found {
+
+		hits.Add(1)
+
+		return series, true, nil
+	}
+
+	keyLock := getKeyLock(key)
+
+	keyLock.Lock()
+
+	defer keyLock.Unlock()
+
+	if series, found := globalCache.Get(key); found {
+
+		hits.Add(1)
+
+		return series, true, nil
+	}
+
+	misses.Add(1)
+
+	columns, err := loader()
+
+	if err != nil {
+
+		return nil, false, err
+	}
+
+	series := &Series{
+
+		columns: columns,
+
+		cost: getColumnsCost(&columns),
+	}
+
+	globalCache.SetWithTTL(key, series, series.cost, seriesTTL)
+
+	globalCache.Wait()
+
+	return series, false, nil
+}
+
+// PeekSeries returns the cached series of an object for the day at path
+// without loading it on a miss. The bool reports a hit.
+func PeekSeries(path string, objectID uint32) (*Series, bool) {
+
+	series, found := globalCache.Get(GetCacheKey(path, objectID))
+
+	if found {
+
+		hits.Add(1)
+
+	} else {
+
+		misses.Add(1)
+	}
+
+	return series, found
+}
+
+// WriteThrough runs put and, if the day of the object is cached, appends
+// point to it so the cached series stays complete.
+func WriteThrough(path string, objectID uint32, point DataPoint, put func() error) error {
+
+	key := GetCacheKey(path, objectID)
+
+	keyLock := getKeyLock(key)
+
+	keyLock.Lock()
+
+	defer keyLock.Unlock()
+
+	if err := put(); err != nil {
+
+		return err
+	}
+
+	series, found := globalCache.Get(key)
+
+	if !found {
+
+		return nil
+	}
+
+	series.lock.Lock()
+
+	if series.columns.Append(point.Timestamp, point.Value) {
+
+		series.cost += getPointCost(point)
+	}
+
+	cost := series.cost
+
+	series.lock.Unlock()
+
+	globalCache.SetWithTTL(key, series, cost, seriesTTL)
+
+	return nil
+}
+
+// AppendRange appends the points of the series within [from, to] to result,
+// which holds the same type.
+func (series *Series) AppendRange(result *Columns, from uint32, to uint32) {
+
+	series.lock.RLock()
+
+	defer series.lock.RUnlock()
+
+	for i, timestamp := range series.columns.Timestamps {
 
-	return globalCache
+		if timestamp >= from && timestamp <= to {
+
+			result.AppendRow(&series.columns, i)
+		}
+	}
 }
 
-func GetMetrics() (hits, misses uint64, hitRatio float64) {
+// CountRange returns how many points of the series are within [from, to].
+func (series *Series) CountRange(from uint32, to uint32) int {
+
+	series.lock.RLock()
+
+	defer series.lock.RUnlock()
+
+	count := 0
+
+	for _, timestamp := range series.columns.Timestamps {
+
+		if timestamp >= from && timestamp <= to {
+
+			count++
+		}
+	}
+
+	return count
+}
+
+// View runs view on the columns of the series, which it must not keep.
+func (series *Series) View(view func(columns *Columns)) {
+
+	series.lock.RLock()
+
+	defer series.lock.RUnlock()
+
+	view(&series.columns)
+}
+
+func getKeyLock(key string) *sync.Mutex {
+
+	hash := fnv.New32a()
+
+	hash.Write([]byte(key))
+
+	return &globalKeyLocks[hash.Sum32()%keyLocks]
+}
+
+func getColumnsCost(columns *Columns) int64 {
+
+	cost := int64(len(columns.Uint64s)+len(columns.Float64s)) * pointCost
+
+	for _, value := range columns.Strings {
+
+		cost += stringCost + int64(len(value))
+	}
+
+	return cost
+}
+
+func getPointCost(point DataPoint) int64 {
+
+	if value, ok := point.Value.(string); ok {
+
+		return stringCost + int64(len(value))
+	}
+
+	return pointCost
+}
 
-	metrics := globalCache.Metrics
+func GetMetrics() (hit, missed uint64, hitRatio float64) {
 
-	hits = metrics.Hits()
+	hit = hits.Load()
 
-	misses = metrics.Misses()
+	missed = misses.Load()
 
-	if hits+misses > 0 {
+	if hit+missed > 0 {
 
-		hitRatio = float64(hits) / float64(hits+misses)
+		hitRatio = float64(hit) / float64(hit+missed)
 	}
 
-	return hits, misses, hitRatio
+	return hit, missed, hitRatio
 }
@@ -0,0 +1,203 @@
+package cache
+
+import (
+	. "reportdb/utils"
+	"sync"
+	"testing"
+)
+
+// disk stands in for the store of one object for one day.
+type disk struct {
+	lock sync.Mutex
+
+	columns Columns
+}
+
+func (disk *disk) put(timestamp uint32) {
+
+	disk.lock.Lock()
+
+	disk.columns.Append(timestamp, uint64(timestamp))
+
+	disk.lock.Unlock()
+}
+
+func (disk *disk) load() (Columns, error) {
+
+	disk.lock.Lock()
+
+	defer disk.lock.Unlock()
+
+	loaded := NewColumns(TypeUint64, disk.columns.Len())
+
+	for i := range disk.columns.Timestamps {
+
+		loaded.AppendRow(&disk.columns, i)
+	}
+
+	return loaded, nil
+}
+
+func TestWriteThroughDuringLoad(t *testing.T) {
+
+	if err := InitCache(); err != nil {
+
+		t.Fatal(err)
+	}
+
+	stored := &disk{columns: NewColumns(TypeUint64, 0)}
+
+	for timestamp := uint32(1); timestamp <= 100; timestamp++ {
+
+		stored.put(timestamp)
+	}
+
+	var waitGroup sync.WaitGroup
+
+	start := make(chan struct{})
+
+	for writer := uint32(0); writer < 4; writer++ {
+
+		waitGroup.Add(1)
+
+		go func(writer uint32) {
+
+			defer waitGroup.Done()
+
+			<-start
+
+			for i := uint32(0); i < 100; i++ {
+
+				timestamp := 1000 + writer*100 + i
+
+				err := WriteThrough("write_during_load", 1, DataPoint{Timestamp: timestamp, Value: uint64(timestamp)}, func() error {
+
+					stored.put(timestamp)
+
+					return nil
+				})
+
+				if err != nil {
+
+					t.Error(err)
+				}
+			}
+		}(writer)
+	}
+
+	close(start)
+
+	series, _, err := LoadSeries("write_during_load", 1, stored.load)
+
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	waitGroup.Wait()
+
+	seen := make(map[uint32]int)
+
+	series.View(func(columns *Columns) {
+
+		for _, timestamp := range columns.Timestamps {
+
+			seen[timestamp]++
+		}
+	})
+
+	if len(seen) != 500 {
+
+		t.Errorf("cached series holds %d timestamps, want 500", len(seen))
+	}
+
+	for timestamp, count := range seen {
+
+		if count != 1 {
+
+			t.Errorf("timestamp %d is cached %d times", timestamp, count)
+		}
+	}
+}
+
+func TestWriteThroughUncached(t *testing.T) {
+
+	if err := InitCache(); err != nil {
+
+		t.Fatal(err)
+	}
+
+	put := 0
+
+	err := WriteThrough("write_uncached", 1, DataPoint{Timestamp: 10, Value: uint64(1)}, func() error {
+
+		put++
+
+		return nil
+	})
+
+	if err != nil || put != 1 {
+
+		t.Fatalf("WriteThrough = %v after %d puts, want one put", err, put)
+	}
+
+	if _, found := PeekSeries("write_uncached", 1); found {
+
+		t.Error("write-through cached a day that wasn't loaded")
+	}
+}
+
+func TestSeriesRange(t *testing.T) {
+
+	series := &Series{columns: NewColumns(TypeUint64, 0)}
+
+	for _, timestamp := range []uint32{10, 20, 30, 40} {
+
+		series.columns.Append(timestamp, uint64(timestamp))
+	}
+
+	tests := []struct {
+		from, to uint32
+
+		want []uint32
+	}{
+		{10, 40, []uint32{10, 20, 30, 40}},
+
+		{20, 30, []uint32{20, 30}},
+
+		{11, 29, []uint32{20}},
+
+		{20, 20, []uint32{20}},
+
+		{41, 50, nil},
+	}
+
+	for _, test := range tests {
+
+		result := NewColumns(TypeUint64, 0)
+
+		series.AppendRange(&result, test.from, test.to)
+
+		if len(result.Timestamps) != len(test.want) {
+
+			t.Errorf("AppendRange(%d, %d) = %v, want %v", test.from, test.to, result.Timestamps, test.want)
+
+		} else {
+
+			for i := range test.want {
+
+				if result.Timestamps[i] != test.want[i] || result.Value(i) != uint64(test.want[i]) {
+
+					t.Errorf("AppendRange(%d, %d) = %v, want %v", test.from, test.to, result.Timestamps, test.want)
+
+					break
+				}
+			}
+		}
+
+		if count := series.CountRange(test.from, test.to); count != len(test.want) {
+
+			t.Errorf("CountRange(%d, %d) = %d, want %d", test.from, test.to, count, len(test.want))
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	. "reportdb/logger"
+	"reportdb/tools"
+	. "reportdb/utils"
+)
+
+var commands = map[string]func(args []string) error{
+
+	"dump": tools.Dump,
+
+	"load": tools.Load,
+
+	"keygen": tools.Keygen,
+}
+
+// runCommand runs a maintenance subcommand such as `reportdb dump ...`
+// instead of the server. It returns false when args name no subcommand.
+func runCommand(args []string) (bool, error) {
+
+	if len(args) == 0 {
+
+		return false, nil
+	}
+
+	command, exists := commands[args[0]]
+
+	if !exists {
+
+		return false, nil
+	}
+
+	if err := InitLogger(); err != nil {
+
+		return true, fmt.Errorf("failed to initialize logger: %v", err)
+	}
+
+	defer Logger.Sync()
+
+	if err := InitConfig(); err != nil {
+
+		return true, fmt.Errorf("error initializing config: %v", err)
+	}
+
+	return true, command(args[1:])
+}
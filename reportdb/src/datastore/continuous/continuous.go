@@ -0,0 +1,644 @@
+package continuous
+
+import (
+	"encoding/json"
+	"fmt"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	. "reportdb/logger"
+	. "reportdb/utils"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	ActionCreate = "create_cq"
+
+	ActionList = "list_cq"
+
+	ActionDelete = "delete_cq"
+
+	maxCatchUpWindows = 100 // windows missed while stopped that are still materialised on start
+
+	firstRequestID = 1 << 63 // keeps internal request IDs apart from the backend's
+)
+
+// ContinuousQueries schedules the continuous queries, runs them through the
+// readers like any other query and writes their results through the writers.
+type ContinuousQueries struct {
+	queries map[string]*runningQuery
+
+	released map[uint16]DataType // target counters of deleted queries, which a new query may take over
+
+	lock sync.Mutex
+
+	path string // ./database/continuous_queries.json
+
+	queryChannel chan QueryReceive
+
+	dataChannel chan []Events
+
+	requestID atomic.Uint64
+
+	waitGroup sync.WaitGroup
+}
+
+type runningQuery struct {
+	definition ContinuousQuery
+
+	targetType DataType
+
+	stop chan struct{}
+}
+
+// savedQueries is the content of continuous_queries.json.
+type savedQueries struct {
+	Queries []ContinuousQuery `json:"queries"`
+
+	Released map[uint16]DataType `json:"released,omitempty"`
+}
+
+type windowResult struct {
+	events []Events
+
+	err error
+}
+
+func NewContinuousQueries(queryChannel chan QueryReceive, dataChannel chan []Events) *ContinuousQueries {
+
+	manager := &ContinuousQueries{
+
+		queries: make(map[string]*runningQuery),
+
+		released: make(map[uint16]DataType),
+
+		path: GetWorkingDirectory() + "/database/continuous_queries.json",
+
+		queryChannel: queryChannel,
+
+		dataChannel: dataChannel,
+	}
+
+	manager.requestID.Store(firstRequestID)
+
+	return manager
+}
+
+// Load registers the target counters of deleted queries, so their data stays
+// queryable, and starts the persisted continuous queries. A counter or query
+// that can't be registered any more is logged and left out.
+func (manager *ContinuousQueries) Load() error {
+
+	data, err := os.ReadFile(manager.path)
+
+	if os.IsNotExist(err) {
+
+		return nil
+	}
+
+	if err != nil {
+
+		return fmt.Errorf("error reading continuous queries: %v", err)
+	}
+
+	var saved savedQueries
+
+	if len(data) > 0 && data[0] == '[' { // saved before deleted queries were kept
+
+		err = json.Unmarshal(data, &saved.Queries)
+
+	} else {
+
+		err = json.Unmarshal(data, &saved)
+	}
+
+	if err != nil {
+
+		return fmt.Errorf("error parsing continuous queries: %v", err)
+	}
+
+	manager.lock.Lock()
+
+	defer manager.lock.Unlock()
+
+	for counterID, dataType := range saved.Released {
+
+		if err := RegisterCounterType(counterID, dataType); err != nil {
+
+			Logger.Error("Skipping counter of a deleted continuous query", zap.Uint16("counter_id", counterID), zap.Error(err))
+
+			continue
+		}
+
+		manager.released[counterID] = dataType
+	}
+
+	for _, definition := range saved.Queries {
+
+		if err := manager.start(definition); err != nil {
+
+			Logger.Error("Skipping continuous query", zap.String("name", definition.Name), zap.Error(err))
+		}
+	}
+
+	Logger.Info("Continuous queries loaded", zap.Int("count", len(manager.queries)))
+
+	return nil
+}
+
+// HandleAdmin answers the continuous query admin commands.
+func (manager *ContinuousQueries) HandleAdmin(command AdminCommand) (interface{}, error) {
+
+	manager.lock.Lock()
+
+	defer manager.lock.Unlock()
+
+	switch command.Action {
+
+	case ActionCreate:
+
+		if command.ContinuousQuery == nil {
+
+			return nil, NewQueryError(ErrInvalidQuery, "%s needs a continuous_query", ActionCreate)
+		}
+
+		definition := *command.ContinuousQuery
+
+		definition.LastRun = 0
+
+		if err := manager.start(definition); err != nil {
+
+			return nil, err
+		}
+
+		return definition, manager.save()
+
+	case ActionList:
+
+		definitions := make([]ContinuousQuery, 0, len(manager.queries))
+
+		for _, running := range manager.queries {
+
+			definitions = append(definitions, running.definition)
+		}
+
+		sort.Slice(definitions, func(i, j int) bool {
+
+			return definitions[i].Name < definitions[j].Name
+		})
+
+		return definitions, nil
+
+	case ActionDelete:
+
+		running, exists := manager.queries[command.Name]
+
+		if !exists {
+
+			return nil, NewQueryError(ErrInvalidQuery, "continuous query %q not found", command.Name)
+		}
+
+		close(running.stop)
+
+		delete(manager.queries, command.Name)
+
+		manager.released[running.definition.TargetCounterID] = running.targetType
+
+		return command.Name, manager.save()
+	}
+
+	return nil, NewQueryError(ErrInvalidQuery, "unknown admin action %q", command.Action)
+}
+
+// start validates definition, registers its target counter and starts its
+// schedule. The caller holds manager.lock.
+func (manager *ContinuousQueries) start(definition ContinuousQuery) error {
+
+	if definition.Name == "" {
+
+		return NewQueryError(ErrInvalidQuery, "continuous query needs a name")
+	}
+
+	if _, exists := manager.queries[definition.Name]; exists {
+
+		return NewQueryError(ErrInvalidQuery, "continuous query %q already exists", definition.Name)
+	}
+
+	if definition.Every <= 0 || definition.Delay < 0 {
+
+		return NewQueryError(ErrInvalidQuery, "continuous query needs a positive every and a delay of 0 or more")
+	}
+
+	if definition.Query.Type != "" {
+
+		return NewQueryError(ErrInvalidQuery, "%s queries can't run continuously", definition.Query.Type)
+	}
+
+	if len(definition.Query.Offsets) > 0 {
+
+		return NewQueryError(ErrInvalidQuery, "continuous queries can't take offsets")
+	}
+
+	if definition.TargetCounterID == 0 || definition.TargetCounterID == definition.Query.CounterID {
+
+		return NewQueryError(ErrInvalidQuery, "continuous query needs a target_counter_id other than its counter_id")
+	}
+
+	definition.Query.Aggregation = strings.ToUpper(definition.Query.Aggregation)
+
+	targetType, err := getTargetType(definition.Query)
+
+	if err != nil {
+
+		return err
+	}
+
+	for _, running := range manager.queries {
+
+		if running.definition.TargetCounterID == definition.TargetCounterID {
+
+			return NewQueryError(ErrInvalidQuery, "counter %d is already written by %q", definition.TargetCounterID, running.definition.Name)
+		}
+	}
+
+	// the counter of a deleted query stays registered, its data is still
+	// there, so a new query can only take it over with the same type
+	if existing, err := GetCounterType(definition.TargetCounterID); err == nil {
+
+		if existing != targetType || manager.released[definition.TargetCounterID] != targetType {
+
+			return NewQueryError(ErrInvalidQuery, "counter %d already exists", definition.TargetCounterID)
+		}
+	}
+
+	if err := RegisterCounterType(definition.TargetCounterID, targetType); err != nil {
+
+		return NewQueryError(ErrInvalidQuery, "%v", err)
+	}
+
+	delete(manager.released, definition.TargetCounterID)
+
+	running := &runningQuery{
+
+		definition: definition,
+
+		targetType: targetType,
+
+		stop: make(chan struct{}),
+	}
+
+	manager.queries[definition.Name] = running
+
+	manager.waitGroup.Add(1)
+
+	go manager.run(running)
+
+	return nil
+}
+
+// run materialises every window of the query once it ended Delay seconds ago.
+func (manager *ContinuousQueries) run(running *runningQuery) {
+
+	defer manager.waitGroup.Done()
+
+	every := uint32(running.definition.Every)
+
+	delay := uint32(running.definition.Delay)
+
+	for {
+
+		manager.lock.Lock()
+
+		lastRun := running.definition.LastRun
+
+		manager.lock.Unlock()
+
+		latest := (uint32(time.Now().Unix()) - delay) / every * every // end of the latest window ready to run
+
+		if lastRun == 0 {
+
+			lastRun = latest - every
+
+		} else if latest > lastRun && (latest-lastRun)/every > maxCatchUpWindows {
+
+			lastRun = latest - maxCatchUpWindows*every
+		}
+
+		windowEnd := lastRun + every
+
+		timer := time.NewTimer(time.Until(time.Unix(int64(windowEnd+delay), 0)))
+
+		select {
+
+		case <-running.stop:
+
+			timer.Stop()
+
+			return
+
+		case <-timer.C:
+		}
+
+		if !manager.runWindow(running, lastRun, windowEnd-1) {
+
+			return
+		}
+
+		manager.lock.Lock()
+
+		running.definition.LastRun = windowEnd
+
+		if manager.queries[running.definition.Name] == running { // not deleted meanwhile
+
+			if err := manager.save(); err != nil {
+
+				Logger.Error("Error saving continuous queries", zap.Error(err))
+			}
+		}
+
+		manager.lock.Unlock()
+	}
+}
+
+// runWindow runs the query over [from, to] and writes the result. It returns
+// false when the query was stopped meanwhile.
+func (manager *ContinuousQueries) runWindow(running *runningQuery, from uint32, to uint32) bool {
+
+	definition := running.definition
+
+	query := definition.Query
+
+	query.From, query.To = from, to
+
+	query.Fill = "null" // empty histogram buckets are left out rather than written as made-up points
+
+	results := make(chan windowResult, 1)
+
+	request := QueryReceive{
+
+		RequestID: manager.requestID.Add(1),
+
+		Query: query,
+
+		Reply: func(response Response) {
+
+			if response.Error != "" {
+
+				results <- windowResult{err: NewQueryError(response.Code, "%s", response.Error)}
+
+				return
+			}
+
+			events, err := getEvents(definition, running.targetType, from, response.Data)
+
+			results <- windowResult{events: events, err: err}
+		},
+	}
+
+	select {
+
+	case <-running.stop:
+
+		return false
+
+	case manager.queryChannel <- request:
+	}
+
+	var result windowResult
+
+	select {
+
+	case <-running.stop:
+
+		return false
+
+	case result = <-results:
+	}
+
+	if result.err != nil {
+
+		if GetErrorCode(result.err) != ErrNoData {
+
+			Logger.Warn("Continuous query failed",
+				zap.String("name", definition.Name),
+				zap.Uint32("from", from),
+				zap.Uint32("to", to),
+				zap.Error(result.err),
+			)
+		}
+
+		return true
+	}
+
+	if len(result.events) > 0 {
+
+		manager.dataChannel <- result.events
+	}
+
+	return true
+}
+
+// save writes the definitions and the target counters of deleted queries.
+// The caller holds manager.lock.
+func (manager *ContinuousQueries) save() error {
+
+	saved := savedQueries{
+
+		Queries: make([]ContinuousQuery, 0, len(manager.queries)),
+
+		Released: manager.released,
+	}
+
+	for _, running := range manager.queries {
+
+		saved.Queries = append(saved.Queries, running.definition)
+	}
+
+	data, err := json.MarshalIndent(saved, "", "  ")
+
+	if err == nil {
+
+		err = os.MkdirAll(filepath.Dir(manager.path), 0755)
+	}
+
+	if err == nil {
+
+		err = os.WriteFile(manager.path+".tmp", data, 0644)
+	}
+
+	if err == nil {
+
+		err = os.Rename(manager.path+".tmp", manager.path)
+	}
+
+	if err != nil {
+
+		return fmt.Errorf("error saving continuous queries: %v", err)
+	}
+
+	return nil
+}
+
+func (manager *ContinuousQueries) Shutdown() {
+
+	manager.lock.Lock()
+
+	for _, running := range manager.queries {
+
+		close(running.stop)
+	}
+
+	manager.lock.Unlock()
+
+	manager.waitGroup.Wait()
+}
+
+// getTargetType returns the type of the counter a query is materialised into.
+func getTargetType(query Query) (DataType, error) {
+
+	sourceType, err := GetCounterType(query.CounterID)
+
+	if err != nil {
+
+		return 0, NewQueryError(ErrInvalidQuery, "%v", err)
+	}
+
+	switch query.Aggregation {
+
+	case "AVG", "MIN", "MAX", "SUM":
+
+		if sourceType != TypeString {
+
+			return TypeFloat64, nil
+		}
+
+	case "COUNT_DISTINCT":
+
+		return TypeUint64, nil
+
+	case "LAST", "FIRST", "MODE":
+
+		return sourceType, nil
+	}
+
+	return 0, NewQueryError(ErrInvalidQuery, "aggregation %q can't be materialised into a counter", query.Aggregation)
+}
+
+// getEvents turns the result of one window into events of the target counter.
+// Results merged over all objects are written to TargetObjectID, gauge and
+// grid results at the start of the window, histogram results per bucket.
+func getEvents(definition ContinuousQuery, targetType DataType, windowStart uint32, data interface{}) ([]Events, error) {
+
+	var events []Events
+
+	var err error
+
+	add := func(objectID uint32, timestamp uint32, value interface{}) {
+
+		if value == nil {
+
+			return // empty bucket
+		}
+
+		converted, ok := convertValue(value, targetType)
+
+		if !ok {
+
+			err = fmt.Errorf("unexpected value %v of type %T for counter %d", value, value, definition.TargetCounterID)
+
+			return
+		}
+
+		events = append(events, Events{
+
+			ObjectId: objectID,
+
+			CounterId: definition.TargetCounterID,
+
+			Timestamp: timestamp,
+
+			Value: converted,
+		})
+	}
+
+	switch result := data.(type) {
+
+	case []DataPoint:
+
+		for _, point := range result {
+
+			add(definition.TargetObjectID, point.Timestamp, point.Value)
+		}
+
+	case map[uint32][]DataPoint:
+
+		for objectID, points := range result {
+
+			for _, point := range points {
+
+				add(objectID, point.Timestamp, point.Value)
+			}
+		}
+
+	case map[uint32]interface{}:
+
+		for objectID, value := range result {
+
+			add(objectID, windowStart, value)
+		}
+
+	default:
+
+		add(definition.TargetObjectID, windowStart, result)
+	}
+
+	return events, err
+}
+
+func convertValue(value interface{}, targetType DataType) (interface{}, bool) {
+
+	switch targetType {
+
+	case TypeFloat64:
+
+		switch number := value.(type) {
+
+		case float64:
+
+			return number, true
+
+		case uint64:
+
+			return float64(number), true
+		}
+
+	case TypeUint64:
+
+		switch number := value.(type) {
+
+		case uint64:
+
+			return number, true
+
+		case int:
+
+			return uint64(number), true
+
+		case float64:
+
+			return uint64(number), true
+		}
+
+	case TypeString:
+
+		text, ok := value.(string)
+
+		return text, ok
+	}
+
+	return nil, false
+}
@@ -0,0 +1,197 @@
+package continuous
+
+import (
+	"go.uber.org/zap"
+	"os"
+	. "reportdb/logger"
+	. "reportdb/utils"
+	"testing"
+	"time"
+)
+
+func TestRecreateAfterDelete(t *testing.T) {
+
+	if err := RegisterCounterType(901, TypeFloat64); err != nil {
+
+		t.Fatal(err)
+	}
+
+	manager := NewContinuousQueries(make(chan QueryReceive), make(chan []Events))
+
+	manager.path = t.TempDir() + "/continuous_queries.json"
+
+	defer manager.Shutdown()
+
+	create := func(name string, aggregation string) error {
+
+		_, err := manager.HandleAdmin(AdminCommand{
+
+			Action: ActionCreate,
+
+			ContinuousQuery: &ContinuousQuery{
+
+				Name: name,
+
+				Query: Query{CounterID: 901, Aggregation: aggregation},
+
+				Every: 3600,
+
+				TargetCounterID: 902,
+			},
+		})
+
+		return err
+	}
+
+	if err := create("hourly", "avg"); err != nil {
+
+		t.Fatal(err)
+	}
+
+	if err := create("other", "max"); GetErrorCode(err) != ErrInvalidQuery {
+
+		t.Fatalf("second query on the same target: error = %v, want code %s", err, ErrInvalidQuery)
+	}
+
+	if _, err := manager.HandleAdmin(AdminCommand{Action: ActionDelete, Name: "hourly"}); err != nil {
+
+		t.Fatal(err)
+	}
+
+	if err := create("count", "count_distinct"); GetErrorCode(err) != ErrInvalidQuery {
+
+		t.Fatalf("recreating with another type: error = %v, want code %s", err, ErrInvalidQuery)
+	}
+
+	if err := create("hourly", "avg"); err != nil {
+
+		t.Fatalf("recreating after delete: %v", err)
+	}
+}
+
+func TestReleasedCountersSurviveRestart(t *testing.T) {
+
+	Logger = zap.NewNop()
+
+	if err := RegisterCounterType(903, TypeFloat64); err != nil {
+
+		t.Fatal(err)
+	}
+
+	path := t.TempDir() + "/continuous_queries.json"
+
+	manager := NewContinuousQueries(make(chan QueryReceive), make(chan []Events))
+
+	manager.path = path
+
+	definition := ContinuousQuery{Name: "hourly", Query: Query{CounterID: 903, Aggregation: "avg"}, Every: 3600, TargetCounterID: 904}
+
+	if _, err := manager.HandleAdmin(AdminCommand{Action: ActionCreate, ContinuousQuery: &definition}); err != nil {
+
+		t.Fatal(err)
+	}
+
+	if _, err := manager.HandleAdmin(AdminCommand{Action: ActionDelete, Name: "hourly"}); err != nil {
+
+		t.Fatal(err)
+	}
+
+	manager.Shutdown()
+
+	restarted := NewContinuousQueries(make(chan QueryReceive), make(chan []Events))
+
+	restarted.path = path
+
+	defer restarted.Shutdown()
+
+	if err := restarted.Load(); err != nil {
+
+		t.Fatal(err)
+	}
+
+	if dataType, err := GetCounterType(904); err != nil || dataType != TypeFloat64 {
+
+		t.Errorf("counter of the deleted query = %d, %v, want float64", dataType, err)
+	}
+
+	if restarted.released[904] != TypeFloat64 {
+
+		t.Fatalf("released after restart = %v, want counter 904 as float64", restarted.released)
+	}
+
+	if _, err := restarted.HandleAdmin(AdminCommand{Action: ActionCreate, ContinuousQuery: &definition}); err != nil {
+
+		t.Fatalf("taking over the counter after restart: %v", err)
+	}
+}
+
+func TestLoadDefinitionsWithoutReleased(t *testing.T) {
+
+	Logger = zap.NewNop()
+
+	if err := RegisterCounterType(905, TypeFloat64); err != nil {
+
+		t.Fatal(err)
+	}
+
+	manager := NewContinuousQueries(make(chan QueryReceive), make(chan []Events))
+
+	manager.path = t.TempDir() + "/continuous_queries.json"
+
+	defer manager.Shutdown()
+
+	saved := `[{"name": "hourly", "query": {"counter_id": 905, "aggregation": "avg"}, "every": 3600, "target_counter_id": 906}]`
+
+	if err := os.WriteFile(manager.path, []byte(saved), 0644); err != nil {
+
+		t.Fatal(err)
+	}
+
+	if err := manager.Load(); err != nil {
+
+		t.Fatal(err)
+	}
+
+	if _, exists := manager.queries["hourly"]; !exists {
+
+		t.Error("query saved as a plain list was not loaded")
+	}
+}
+
+func TestRunWindowFillsNull(t *testing.T) {
+
+	queries := make(chan QueryReceive, 1)
+
+	manager := NewContinuousQueries(queries, make(chan []Events, 1))
+
+	running := &runningQuery{
+
+		definition: ContinuousQuery{Query: Query{CounterID: 907, Aggregation: "AVG", Interval: 60}, TargetCounterID: 908},
+
+		targetType: TypeFloat64,
+
+		stop: make(chan struct{}),
+	}
+
+	done := make(chan bool)
+
+	go func() { done <- manager.runWindow(running, 0, 3599) }()
+
+	request := <-queries
+
+	if request.Query.Fill != "null" {
+
+		t.Errorf("fill = %q, want null", request.Query.Fill)
+	}
+
+	request.Reply(Response{Data: []DataPoint{}})
+
+	select {
+
+	case <-done:
+
+	case <-time.After(time.Second):
+
+		t.Fatal("runWindow did not return")
+	}
+}
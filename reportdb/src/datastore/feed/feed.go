@@ -0,0 +1,95 @@
+package feed
+
+import (
+	. "reportdb/utils"
+	"sync"
+	"sync/atomic"
+)
+
+// Feed hands every event the writers stored to its subscriptions. Publishing
+// never blocks, a subscription whose buffer is full drops the event and counts
+// it, so a slow consumer can't stall the writers.
+type Feed struct {
+	subscriptions map[*Subscription]struct{}
+
+	lock sync.RWMutex
+}
+
+// Subscription receives every event, consumers filter what they need.
+type Subscription struct {
+	Events chan Events
+
+	dropped atomic.Uint64
+}
+
+func NewFeed() *Feed {
+
+	return &Feed{
+
+		subscriptions: make(map[*Subscription]struct{}),
+	}
+}
+
+// Subscribe starts a subscription buffering up to buffer events.
+func (feed *Feed) Subscribe(buffer int) *Subscription {
+
+	subscription := &Subscription{
+
+		Events: make(chan Events, buffer),
+	}
+
+	feed.lock.Lock()
+
+	feed.subscriptions[subscription] = struct{}{}
+
+	feed.lock.Unlock()
+
+	return subscription
+}
+
+// Unsubscribe stops a subscription and closes its channel.
+func (feed *Feed) Unsubscribe(subscription *Subscription) {
+
+	feed.lock.Lock()
+
+	defer feed.lock.Unlock()
+
+	if _, exists := feed.subscriptions[subscription]; exists {
+
+		delete(feed.subscriptions, subscription)
+
+		close(subscription.Events)
+	}
+}
+
+// Publish offers an event to every subscription. A nil feed
+// publishes nothing, for writers started without one.
+func (feed *Feed) Publish(event Events) {
+
+	if feed == nil {
+
+		return
+	}
+
+	feed.lock.RLock()
+
+	defer feed.lock.RUnlock()
+
+	for subscription := range feed.subscriptions {
+
+		select {
+
+		case subscription.Events <- event:
+
+		default:
+
+			subscription.dropped.Add(1)
+		}
+	}
+}
+
+// Dropped returns how many events didn't fit in the buffer.
+func (subscription *Subscription) Dropped() uint64 {
+
+	return subscription.dropped.Load()
+}
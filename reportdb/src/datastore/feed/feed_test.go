@@ -0,0 +1,43 @@
+package feed
+
+import (
+	. "reportdb/utils"
+	"testing"
+)
+
+func TestFeed(t *testing.T) {
+
+	feed := NewFeed()
+
+	subscription := feed.Subscribe(1)
+
+	for timestamp := uint32(1); timestamp <= 3; timestamp++ {
+
+		feed.Publish(Events{ObjectId: 10, CounterId: 2, Timestamp: timestamp})
+	}
+
+	if event := <-subscription.Events; event.Timestamp != 1 {
+
+		t.Errorf("received %+v, want the first event", event)
+	}
+
+	if dropped := subscription.Dropped(); dropped != 2 {
+
+		t.Errorf("Dropped = %d, want 2", dropped)
+	}
+
+	feed.Unsubscribe(subscription)
+
+	if _, open := <-subscription.Events; open {
+
+		t.Error("Unsubscribe left the channel open")
+	}
+
+	feed.Unsubscribe(subscription) // twice is harmless
+
+	feed.Publish(Events{Timestamp: 4}) // without subscriptions
+
+	var none *Feed
+
+	none.Publish(Events{Timestamp: 5}) // writers started without a feed
+}
@@ -0,0 +1,228 @@
+package reader
+
+import (
+	. "reportdb/utils"
+	"sort"
+)
+
+type number interface {
+	uint64 | float64
+}
+
+// accumulator folds numeric values into every numeric aggregate at once, so
+// values never have to be kept or boxed.
+type accumulator struct {
+	count int
+
+	sum float64
+
+	min float64
+
+	max float64
+}
+
+func isNumericAggregation(aggregation string) bool {
+
+	switch aggregation {
+
+	case "AVG", "MIN", "MAX", "SUM":
+
+		return true
+	}
+
+	return false
+}
+
+func (acc *accumulator) add(value float64) {
+
+	if acc.count == 0 || value < acc.min {
+
+		acc.min = value
+	}
+
+	if acc.count == 0 || value > acc.max {
+
+		acc.max = value
+	}
+
+	acc.sum += value
+
+	acc.count++
+}
+
+func addValues[T number](acc *accumulator, values []T) {
+
+	if len(values) == 0 {
+
+		return
+	}
+
+	sum, minValue, maxValue := acc.sum, float64(values[0]), float64(values[0])
+
+	if acc.count > 0 {
+
+		minValue, maxValue = acc.min, acc.max
+	}
+
+	for _, value := range values {
+
+		converted := float64(value)
+
+		sum += converted
+
+		if converted < minValue {
+
+			minValue = converted
+		}
+
+		if converted > maxValue {
+
+			maxValue = converted
+		}
+	}
+
+	acc.sum, acc.min, acc.max = sum, minValue, maxValue
+
+	acc.count += len(values)
+}
+
+// addColumns adds every value of numeric columns.
+func (acc *accumulator) addColumns(columns *Columns) {
+
+	switch columns.Type {
+
+	case TypeUint64:
+
+		addValues(acc, columns.Uint64s)
+
+	case TypeFloat64:
+
+		addValues(acc, columns.Float64s)
+	}
+}
+
+// result returns the aggregate, nil when nothing was added.
+func (acc *accumulator) result(aggregation string) interface{} {
+
+	if acc.count == 0 {
+
+		return nil
+	}
+
+	switch aggregation {
+
+	case "AVG":
+
+		return acc.sum / float64(acc.count)
+
+	case "MIN":
+
+		return acc.min
+
+	case "MAX":
+
+		return acc.max
+
+	case "SUM":
+
+		return acc.sum
+	}
+
+	return nil
+}
+
+// bucketFolder adds values to the accumulator of the bucket they fall in.
+// Values may come in any order, but in order the bucket is found in O(1).
+type bucketFolder struct {
+	starts []uint32
+
+	from uint32
+
+	to uint32
+
+	accumulators []accumulator
+
+	bucket int
+
+	points int64 // values added
+}
+
+func newBucketFolder(starts []uint32, from uint32, to uint32, accumulators []accumulator) *bucketFolder {
+
+	return &bucketFolder{
+
+		starts: starts,
+
+		from: from,
+
+		to: to,
+
+		accumulators: accumulators,
+	}
+}
+
+func (folder *bucketFolder) add(timestamp uint32, value float64) {
+
+	if timestamp < folder.from || timestamp > folder.to || len(folder.starts) == 0 || timestamp < folder.starts[0] {
+
+		return
+	}
+
+	if timestamp < folder.starts[folder.bucket] || (folder.bucket+1 < len(folder.starts) && timestamp >= folder.starts[folder.bucket+1]) {
+
+		folder.findBucket(timestamp)
+	}
+
+	folder.accumulators[folder.bucket].add(value)
+
+	folder.points++
+}
+
+func (folder *bucketFolder) findBucket(timestamp uint32) {
+
+	folder.bucket = sort.Search(len(folder.starts), func(i int) bool {
+
+		return folder.starts[i] > timestamp
+	}) - 1
+}
+
+// addColumns adds every value of numeric columns.
+func (folder *bucketFolder) addColumns(columns *Columns) {
+
+	switch columns.Type {
+
+	case TypeUint64:
+
+		foldValues(folder, columns.Timestamps, columns.Uint64s)
+
+	case TypeFloat64:
+
+		foldValues(folder, columns.Timestamps, columns.Float64s)
+	}
+}
+
+func foldValues[T number](folder *bucketFolder, timestamps []uint32, values []T) {
+
+	for i, timestamp := range timestamps {
+
+		folder.add(timestamp, float64(values[i]))
+	}
+}
+
+// getBucketPoints returns the aggregate of every bucket, nil for empty ones.
+func getBucketPoints(starts []uint32, accumulators []accumulator, aggregation string) []DataPoint {
+
+	bucketed := make([]DataPoint, len(starts))
+
+	for i, start := range starts {
+
+		bucketed[i] = DataPoint{
+
+			Timestamp: start,
+
+			Value: accumulators[i].result(aggregation), // nil for empty buckets, filled later
+		}
+	}
+
+	return bucketed
+}
@@ -0,0 +1,279 @@
+package reader
+
+import (
+	"math"
+	. "reportdb/utils"
+	"sort"
+	"strings"
+)
+
+const (
+	queryTypeBaseline = "baseline"
+
+	baselineStddev = "stddev"
+
+	baselineSeasonal = "seasonal"
+
+	defaultBaselineK = 3
+
+	defaultBaselineWindow = 12
+
+	defaultBaselineSeason = 7 * 24 * 60 * 60
+
+	defaultBaselineSeasons = 4
+)
+
+// baselinePoint is one bucket of a baseline query. Mean, Lower and Upper are
+// nil while fewer than two earlier samples are known.
+type baselinePoint struct {
+	Timestamp uint32 `json:"timestamp"`
+
+	Value interface{} `json:"value"`
+
+	Mean interface{} `json:"mean"`
+
+	Lower interface{} `json:"lower"`
+
+	Upper interface{} `json:"upper"`
+
+	Anomaly bool `json:"anomaly"`
+}
+
+func getBaselineOptions(query Query) (BaselineOptions, error) {
+
+	var options BaselineOptions
+
+	if query.Baseline != nil {
+
+		options = *query.Baseline
+	}
+
+	if !isHistogram(query) {
+
+		return options, NewQueryError(ErrInvalidQuery, "baseline queries need an interval or calendar_interval")
+	}
+
+	options.Method = strings.ToLower(options.Method)
+
+	if options.Method == "" {
+
+		options.Method = baselineStddev
+	}
+
+	if options.Method != baselineStddev && options.Method != baselineSeasonal {
+
+		return options, NewQueryError(ErrInvalidQuery, "invalid baseline method %q, expected stddev or seasonal", options.Method)
+	}
+
+	if options.K == 0 {
+
+		options.K = defaultBaselineK
+	}
+
+	if options.Window == 0 {
+
+		options.Window = defaultBaselineWindow
+	}
+
+	if options.Season == 0 {
+
+		options.Season = defaultBaselineSeason
+	}
+
+	if options.Seasons == 0 {
+
+		options.Seasons = defaultBaselineSeasons
+	}
+
+	if options.K < 0 || options.Window < 2 || options.Season < 0 || options.Seasons < 2 {
+
+		return options, NewQueryError(ErrInvalidQuery, "invalid baseline options, k must be positive and window and seasons at least 2")
+	}
+
+	return options, nil
+}
+
+// getBaselineFrom returns how far back a baseline query reads, so the first
+// bucket in range already has a full history.
+func getBaselineFrom(query Query) (uint32, error) {
+
+	options, err := getBaselineOptions(query)
+
+	if err != nil {
+
+		return 0, err
+	}
+
+	lookback := int64(options.Seasons) * int64(options.Season)
+
+	if options.Method == baselineStddev {
+
+		duration, err := getBucketDuration(query)
+
+		if err != nil {
+
+			return 0, err
+		}
+
+		lookback = int64(options.Window) * duration
+	}
+
+	return uint32(max(int64(query.From)-lookback, 0)), nil
+}
+
+// BaselineQuery buckets the range together with its history and returns, for
+// every bucket in range, the actual value and a band of mean ± k·stddev of
+// the buckets before it (stddev) or of the same bucket in earlier seasons
+// (seasonal). Buckets outside the band are flagged as anomalies.
+func (reader *Reader) BaselineQuery(query Query, dataType DataType) (interface{}, error) {
+
+	if dataType == TypeString {
+
+		return nil, NewQueryError(ErrInvalidQuery, "baseline queries need a numeric counter")
+	}
+
+	options, err := getBaselineOptions(query)
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	aggregation := strings.ToUpper(query.Aggregation)
+
+	switch aggregation {
+
+	case "":
+
+		aggregation = "AVG"
+
+	case "AVG", "MIN", "MAX", "SUM":
+
+	default:
+
+		return nil, NewQueryError(ErrInvalidQuery, "baseline queries need a numeric aggregation, got %q", query.Aggregation)
+	}
+
+	historyQuery := query
+
+	if historyQuery.From, err = getBaselineFrom(query); err != nil {
+
+		return nil, err
+	}
+
+	starts, err := getBucketStarts(historyQuery)
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	bucketed := reader.bucketData(starts, historyQuery.From, query.To, aggregation)
+
+	if query.GroupByObjects {
+
+		result := make(map[uint32][]baselinePoint, len(bucketed))
+
+		for objectID, points := range bucketed {
+
+			result[objectID] = getBaselineBand(points, query.From, options)
+		}
+
+		return result, nil
+	}
+
+	return getBaselineBand(reader.mergeAllObjects(bucketed, aggregation), query.From, options), nil
+}
+
+// getBaselineBand computes the band of every bucket from the bucket holding
+// from on. Points are the buckets of one series, sorted by timestamp.
+func getBaselineBand(points []DataPoint, from uint32, options BaselineOptions) []baselinePoint {
+
+	first := max(sort.Search(len(points), func(i int) bool { return points[i].Timestamp > from })-1, 0)
+
+	band := make([]baselinePoint, 0, len(points)-first)
+
+	samples := make([]float64, 0, max(options.Window, options.Seasons))
+
+	for i := first; i < len(points); i++ {
+
+		samples = samples[:0]
+
+		if options.Method == baselineStddev {
+
+			for j := max(i-options.Window, 0); j < i; j++ {
+
+				if value, ok := convertToFloat64(points[j].Value); ok {
+
+					samples = append(samples, value)
+				}
+			}
+
+		} else {
+
+			for season := 1; season <= options.Seasons; season++ {
+
+				timestamp := int64(points[i].Timestamp) - int64(season)*int64(options.Season)
+
+				// the bucket holding the same moment one or more seasons ago
+				j := sort.Search(i, func(k int) bool { return int64(points[k].Timestamp) > timestamp }) - 1
+
+				if j < 0 {
+
+					break
+				}
+
+				if value, ok := convertToFloat64(points[j].Value); ok {
+
+					samples = append(samples, value)
+				}
+			}
+		}
+
+		entry := baselinePoint{
+
+			Timestamp: points[i].Timestamp,
+
+			Value: points[i].Value,
+		}
+
+		if len(samples) >= 2 {
+
+			mean, stddev := getMeanAndStddev(samples)
+
+			lower, upper := mean-options.K*stddev, mean+options.K*stddev
+
+			entry.Mean, entry.Lower, entry.Upper = mean, lower, upper
+
+			if value, ok := convertToFloat64(points[i].Value); ok {
+
+				entry.Anomaly = value < lower || value > upper
+			}
+		}
+
+		band = append(band, entry)
+	}
+
+	return band
+}
+
+func getMeanAndStddev(samples []float64) (float64, float64) {
+
+	sum := 0.0
+
+	for _, sample := range samples {
+
+		sum += sample
+	}
+
+	mean := sum / float64(len(samples))
+
+	variance := 0.0
+
+	for _, sample := range samples {
+
+		variance += (sample - mean) * (sample - mean)
+	}
+
+	return mean, math.Sqrt(variance / float64(len(samples)))
+}
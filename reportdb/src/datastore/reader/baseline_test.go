@@ -0,0 +1,183 @@
+package reader
+
+import (
+	"reflect"
+	. "reportdb/utils"
+	"testing"
+)
+
+func TestGetBaselineBand(t *testing.T) {
+
+	series := func(values ...interface{}) []DataPoint {
+
+		points := make([]DataPoint, len(values))
+
+		for i, value := range values {
+
+			points[i] = DataPoint{Timestamp: uint32(i * 60), Value: value}
+		}
+
+		return points
+	}
+
+	// band returns the mean, lower and upper bounds of every bucket, nil
+	// where there is no band, and which buckets are anomalies
+	band := func(points []baselinePoint) ([]interface{}, []bool) {
+
+		var bounds []interface{}
+
+		var anomalies []bool
+
+		for _, point := range points {
+
+			bound := interface{}(nil)
+
+			if point.Mean != nil {
+
+				bound = [3]float64{point.Mean.(float64), point.Lower.(float64), point.Upper.(float64)}
+			}
+
+			bounds = append(bounds, bound)
+
+			anomalies = append(anomalies, point.Anomaly)
+		}
+
+		return bounds, anomalies
+	}
+
+	tests := []struct {
+		name string
+
+		points []DataPoint
+
+		from uint32
+
+		options BaselineOptions
+
+		bounds []interface{}
+
+		anomalies []bool
+	}{
+		{
+			name: "stddev over the window",
+
+			points: series(10.0, 20.0, 10.0, 20.0, 100.0),
+
+			options: BaselineOptions{Method: baselineStddev, K: 2, Window: 2},
+
+			// no history, then a single sample, below the two a band needs
+			bounds: []interface{}{nil, nil, [3]float64{15, 5, 25}, [3]float64{15, 5, 25}, [3]float64{15, 5, 25}},
+
+			anomalies: []bool{false, false, false, false, true},
+		},
+		{
+			name: "from a later bucket",
+
+			points: series(10.0, 20.0, 10.0, 20.0, 100.0),
+
+			from: 180,
+
+			options: BaselineOptions{Method: baselineStddev, K: 2, Window: 2},
+
+			bounds: []interface{}{[3]float64{15, 5, 25}, [3]float64{15, 5, 25}},
+
+			anomalies: []bool{false, true},
+		},
+		{
+			name: "empty buckets aren't samples",
+
+			points: series(10.0, nil, 20.0, nil, 30.0),
+
+			options: BaselineOptions{Method: baselineStddev, K: 1, Window: 4},
+
+			bounds: []interface{}{nil, nil, nil, [3]float64{15, 10, 20}, [3]float64{15, 10, 20}},
+
+			anomalies: []bool{false, false, false, false, true},
+		},
+		{
+			name: "seasonal",
+
+			// a season of two buckets, the band of a bucket comes from the
+			// buckets two and four before it
+			points: series(10.0, 0.0, 20.0, 0.0, 15.0, 0.0),
+
+			options: BaselineOptions{Method: baselineSeasonal, K: 1, Season: 120, Seasons: 2},
+
+			bounds: []interface{}{nil, nil, nil, nil, [3]float64{15, 10, 20}, [3]float64{0, 0, 0}},
+
+			anomalies: []bool{false, false, false, false, false, false},
+		},
+		{
+			name: "seasonal without earlier seasons",
+
+			points: series(10.0, 20.0, 30.0),
+
+			options: BaselineOptions{Method: baselineSeasonal, K: 1, Season: 3600, Seasons: 2},
+
+			bounds: []interface{}{nil, nil, nil},
+
+			anomalies: []bool{false, false, false},
+		},
+	}
+
+	for _, test := range tests {
+
+		bounds, anomalies := band(getBaselineBand(test.points, test.from, test.options))
+
+		if !reflect.DeepEqual(bounds, test.bounds) || !reflect.DeepEqual(anomalies, test.anomalies) {
+
+			t.Errorf("%s: band = %v %v, want %v %v", test.name, bounds, anomalies, test.bounds, test.anomalies)
+		}
+	}
+}
+
+func TestGetBaselineOptions(t *testing.T) {
+
+	tests := []struct {
+		name string
+
+		baseline *BaselineOptions
+
+		interval int
+
+		want BaselineOptions
+
+		code string
+	}{
+		{
+			name: "defaults",
+
+			interval: 60,
+
+			want: BaselineOptions{Method: baselineStddev, K: defaultBaselineK, Window: defaultBaselineWindow, Season: defaultBaselineSeason, Seasons: defaultBaselineSeasons},
+		},
+
+		{name: "gauge", code: ErrInvalidQuery},
+
+		{name: "unknown method", baseline: &BaselineOptions{Method: "median"}, interval: 60, code: ErrInvalidQuery},
+
+		{name: "window below the minimum", baseline: &BaselineOptions{Window: 1}, interval: 60, code: ErrInvalidQuery},
+
+		{name: "seasons below the minimum", baseline: &BaselineOptions{Method: baselineSeasonal, Seasons: 1}, interval: 60, code: ErrInvalidQuery},
+	}
+
+	for _, test := range tests {
+
+		options, err := getBaselineOptions(Query{Interval: test.interval, Baseline: test.baseline})
+
+		if test.code != "" {
+
+			if GetErrorCode(err) != test.code {
+
+				t.Errorf("%s: error = %v, want code %s", test.name, err, test.code)
+			}
+
+			continue
+		}
+
+		if err != nil || options != test.want {
+
+			t.Errorf("%s: getBaselineOptions = %+v, %v, want %+v", test.name, options, err, test.want)
+		}
+	}
+}
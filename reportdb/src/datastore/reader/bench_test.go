@@ -0,0 +1,147 @@
+package reader
+
+import (
+	"encoding/binary"
+	"math"
+	. "reportdb/utils"
+	"testing"
+)
+
+const (
+	benchPoints = 24 * 60 * 60 // one day of samples a second apart
+
+	benchInterval = 5 * 60
+)
+
+// getBenchRecords returns the stored records of one float64 series.
+func getBenchRecords() [][]byte {
+
+	records := make([][]byte, benchPoints)
+
+	for i := range records {
+
+		records[i] = make([]byte, 12)
+
+		binary.LittleEndian.PutUint32(records[i], uint32(i))
+
+		binary.LittleEndian.PutUint64(records[i][4:], math.Float64bits(float64(i%1000)/10))
+	}
+
+	return records
+}
+
+func getBenchColumns() Columns {
+
+	records := getBenchRecords()
+
+	columns := NewColumns(TypeFloat64, len(records))
+
+	DecodeColumns(records, &columns)
+
+	return columns
+}
+
+func BenchmarkDecodeData(b *testing.B) {
+
+	records := getBenchRecords()
+
+	b.ReportAllocs()
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+
+		var decoded []DataPoint
+
+		DecodeData(records, TypeFloat64, &decoded)
+	}
+}
+
+func BenchmarkDecodeColumns(b *testing.B) {
+
+	records := getBenchRecords()
+
+	b.ReportAllocs()
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+
+		decoded := NewColumns(TypeFloat64, len(records))
+
+		DecodeColumns(records, &decoded)
+	}
+}
+
+func BenchmarkGauge(b *testing.B) {
+
+	columns := getBenchColumns()
+
+	b.ReportAllocs()
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+
+		var acc accumulator
+
+		acc.addColumns(&columns)
+
+		acc.result("AVG")
+	}
+}
+
+func BenchmarkHistogram(b *testing.B) {
+
+	columns := getBenchColumns()
+
+	query := Query{From: 0, To: benchPoints - 1, Interval: benchInterval}
+
+	starts, err := getBucketStarts(query)
+
+	if err != nil {
+
+		b.Fatal(err)
+	}
+
+	reader := newReader(nil)
+
+	b.ReportAllocs()
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+
+		reader.createBuckets(&columns, starts, query.From, query.To, "AVG")
+	}
+}
+
+func BenchmarkStringHistogram(b *testing.B) {
+
+	columns := NewColumns(TypeString, benchPoints)
+
+	for i := 0; i < benchPoints; i++ {
+
+		columns.Append(uint32(i), []string{"up", "down", "degraded"}[i%3])
+	}
+
+	query := Query{From: 0, To: benchPoints - 1, Interval: benchInterval}
+
+	starts, err := getBucketStarts(query)
+
+	if err != nil {
+
+		b.Fatal(err)
+	}
+
+	reader := newReader(nil)
+
+	b.ReportAllocs()
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+
+		reader.createBuckets(&columns, starts, query.From, query.To, "MODE")
+	}
+}
@@ -0,0 +1,184 @@
+package reader
+
+import (
+	. "reportdb/utils"
+	"strconv"
+	"time"
+)
+
+const maxBuckets = 200000 // per query, enough for 1 minute buckets over 90 days
+
+// getBucketStarts returns the start of every bucket between query.From and
+// query.To. Fixed intervals are aligned to the zone offset at query.From,
+// calendar intervals (1d, 1w, 1M) to local midnight, Monday and the first day
+// of the month, so DST days are simply 23 or 25 hours long.
+func getBucketStarts(query Query) ([]uint32, error) {
+
+	location := time.UTC
+
+	if query.Timezone != "" {
+
+		var err error
+
+		location, err = time.LoadLocation(query.Timezone)
+
+		if err != nil {
+
+			return nil, NewQueryError(ErrInvalidQuery, "invalid timezone %q: %v", query.Timezone, err)
+		}
+	}
+
+	if query.CalendarInterval != "" {
+
+		if query.Interval != 0 {
+
+			return nil, NewQueryError(ErrInvalidQuery, "interval and calendar_interval can't be used together")
+		}
+
+		return getCalendarBucketStarts(query.CalendarInterval, query.From, query.To, location)
+	}
+
+	if query.Interval <= 0 {
+
+		return nil, NewQueryError(ErrInvalidQuery, "invalid interval %d", query.Interval)
+	}
+
+	interval := int64(query.Interval)
+
+	from := int64(query.From)
+
+	_, offset := time.Unix(from, 0).In(location).Zone()
+
+	first := max(from-((from+int64(offset))%interval+interval)%interval, 0) // a from near 0 would align before the epoch
+
+	count := (int64(query.To)-first)/interval + 1
+
+	if count > maxBuckets {
+
+		return nil, NewQueryError(ErrQueryTooLarge, "query has %d buckets, the limit is %d", count, maxBuckets)
+	}
+
+	starts := make([]uint32, 0, max(count, 0))
+
+	for start := first; start <= int64(query.To); start += interval {
+
+		starts = append(starts, uint32(start))
+	}
+
+	return starts, nil
+}
+
+func getCalendarBucketStarts(calendarInterval string, from uint32, to uint32, location *time.Location) ([]uint32, error) {
+
+	count, unit, err := parseCalendarInterval(calendarInterval)
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	local := time.Unix(int64(from), 0).In(location)
+
+	year, month, day := local.Date()
+
+	switch unit {
+
+	case 'w':
+
+		day -= (int(local.Weekday()) + 6) % 7 // weeks start on Monday
+
+	case 'M':
+
+		day = 1
+	}
+
+	var starts []uint32
+
+	for i := 0; ; i++ {
+
+		var start time.Time
+
+		switch unit {
+
+		case 'd':
+
+			start = time.Date(year, month, day+i*count, 0, 0, 0, 0, location)
+
+		case 'w':
+
+			start = time.Date(year, month, day+i*count*7, 0, 0, 0, 0, location)
+
+		case 'M':
+
+			start = time.Date(year, month+time.Month(i*count), day, 0, 0, 0, 0, location)
+		}
+
+		if start.Unix() > int64(to) {
+
+			break
+		}
+
+		if len(starts) == maxBuckets {
+
+			return nil, NewQueryError(ErrQueryTooLarge, "query has more than %d buckets", maxBuckets)
+		}
+
+		starts = append(starts, uint32(max(start.Unix(), 0)))
+	}
+
+	return starts, nil
+}
+
+func parseCalendarInterval(calendarInterval string) (int, byte, error) {
+
+	if len(calendarInterval) < 2 {
+
+		return 0, 0, NewQueryError(ErrInvalidQuery, "invalid calendar_interval %q", calendarInterval)
+	}
+
+	unit := calendarInterval[len(calendarInterval)-1]
+
+	count, err := strconv.Atoi(calendarInterval[:len(calendarInterval)-1])
+
+	if err != nil || count <= 0 || (unit != 'd' && unit != 'w' && unit != 'M') {
+
+		return 0, 0, NewQueryError(ErrInvalidQuery, "invalid calendar_interval %q, expected e.g. 1d, 1w or 1M", calendarInterval)
+	}
+
+	return count, unit, nil
+}
+
+func isHistogram(query Query) bool {
+
+	return query.Interval != 0 || query.CalendarInterval != ""
+}
+
+// getBucketDuration returns the length of a bucket in seconds, the longest
+// one for calendar intervals.
+func getBucketDuration(query Query) (int64, error) {
+
+	if query.CalendarInterval == "" {
+
+		return int64(query.Interval), nil
+	}
+
+	count, unit, err := parseCalendarInterval(query.CalendarInterval)
+
+	if err != nil {
+
+		return 0, err
+	}
+
+	switch unit {
+
+	case 'd':
+
+		return int64(count) * 25 * 60 * 60, nil
+
+	case 'w':
+
+		return int64(count) * (7*24 + 1) * 60 * 60, nil
+	}
+
+	return int64(count) * (31*24 + 1) * 60 * 60, nil
+}
@@ -0,0 +1,129 @@
+package reader
+
+import (
+	"reflect"
+	. "reportdb/utils"
+	"testing"
+	"time"
+)
+
+func TestGetBucketStarts(t *testing.T) {
+
+	newYork, err := time.LoadLocation("America/New_York")
+
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	local := func(year int, month time.Month, day int, hour int) uint32 {
+
+		return uint32(time.Date(year, month, day, hour, 0, 0, 0, newYork).Unix())
+	}
+
+	utc := func(year int, month time.Month, day int) uint32 {
+
+		return uint32(time.Date(year, month, day, 0, 0, 0, 0, time.UTC).Unix())
+	}
+
+	tests := []struct {
+		name string
+
+		query Query
+
+		want []uint32
+
+		code string
+	}{
+		{
+			name: "fixed interval aligned to UTC",
+
+			query: Query{From: 7300, To: 14400, Interval: 3600},
+
+			want: []uint32{7200, 10800, 14400},
+		},
+		{
+			name: "fixed interval aligned to the zone offset",
+
+			query: Query{From: 10000, To: 13000, Interval: 3600, Timezone: "Asia/Kolkata"},
+
+			want: []uint32{9000, 12600},
+		},
+		{
+			name: "alignment before the epoch is clamped",
+
+			query: Query{From: 100, To: 3000, Interval: 3600, Timezone: "Asia/Kolkata"},
+
+			want: []uint32{0},
+		},
+		{
+			name: "days across the DST change",
+
+			query: Query{From: local(2024, 3, 9, 12), To: local(2024, 3, 11, 12), CalendarInterval: "1d", Timezone: "America/New_York"},
+
+			want: []uint32{local(2024, 3, 9, 0), local(2024, 3, 10, 0), local(2024, 3, 11, 0)},
+		},
+		{
+			name: "weeks start on Monday",
+
+			query: Query{From: utc(2024, 1, 3), To: utc(2024, 1, 10), CalendarInterval: "1w"},
+
+			want: []uint32{utc(2024, 1, 1), utc(2024, 1, 8)},
+		},
+		{
+			name: "months",
+
+			query: Query{From: utc(2024, 1, 15), To: utc(2024, 3, 20), CalendarInterval: "1M"},
+
+			want: []uint32{utc(2024, 1, 1), utc(2024, 2, 1), utc(2024, 3, 1)},
+		},
+		{
+			name: "too many fixed buckets",
+
+			query: Query{From: 0, To: 90 * 24 * 60 * 60, Interval: 1},
+
+			code: ErrQueryTooLarge,
+		},
+		{
+			name: "interval and calendar interval",
+
+			query: Query{From: 0, To: 100, Interval: 60, CalendarInterval: "1d"},
+
+			code: ErrInvalidQuery,
+		},
+		{
+			name: "unknown calendar unit",
+
+			query: Query{From: 0, To: 100, CalendarInterval: "1y"},
+
+			code: ErrInvalidQuery,
+		},
+		{
+			name: "unknown timezone",
+
+			query: Query{From: 0, To: 100, Interval: 60, Timezone: "Mars/Olympus"},
+
+			code: ErrInvalidQuery,
+		},
+	}
+
+	for _, test := range tests {
+
+		starts, err := getBucketStarts(test.query)
+
+		if test.code != "" {
+
+			if GetErrorCode(err) != test.code {
+
+				t.Errorf("%s: error = %v, want code %s", test.name, err, test.code)
+			}
+
+			continue
+		}
+
+		if err != nil || !reflect.DeepEqual(starts, test.want) {
+
+			t.Errorf("%s: getBucketStarts = %v, %v, want %v", test.name, starts, err, test.want)
+		}
+	}
+}
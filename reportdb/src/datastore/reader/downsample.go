@@ -0,0 +1,269 @@
+package reader
+
+import (
+	"math"
+	. "reportdb/utils"
+	"strings"
+)
+
+const (
+	downsampleLTTB = "lttb"
+
+	downsampleMinMax = "minmax"
+
+	minMaxPoints = 3
+)
+
+// getDownsampleMethod validates the downsampling of a query, only raw queries
+// and numeric histograms are downsampled.
+func getDownsampleMethod(query Query) (string, error) {
+
+	method := strings.ToLower(query.Downsample)
+
+	if method == "" {
+
+		method = downsampleLTTB
+	}
+
+	if method != downsampleLTTB && method != downsampleMinMax {
+
+		return method, NewQueryError(ErrInvalidQuery, "invalid downsample %q, expected lttb or minmax", query.Downsample)
+	}
+
+	if query.MaxPoints == 0 {
+
+		return method, nil
+	}
+
+	if query.MaxPoints < minMaxPoints {
+
+		return method, NewQueryError(ErrInvalidQuery, "max_points must be at least %d", minMaxPoints)
+	}
+
+	if query.Type == queryTypeRaw || (query.Type == "" && isHistogram(query) && isNumericAggregation(query.Aggregation)) {
+
+		return method, nil
+	}
+
+	return method, NewQueryError(ErrInvalidQuery, "max_points needs a raw query or a histogram with an avg, min, max or sum aggregation")
+}
+
+// downsampleHistogram caps every series of a histogram, merged or grouped by
+// objects, at maxPoints points.
+func downsampleHistogram(histogram interface{}, maxPoints int, method string) interface{} {
+
+	switch series := histogram.(type) {
+
+	case []DataPoint:
+
+		return downsamplePoints(series, maxPoints, method)
+
+	case map[uint32][]DataPoint:
+
+		for objectID, points := range series {
+
+			series[objectID] = downsamplePoints(points, maxPoints, method)
+		}
+	}
+
+	return histogram
+}
+
+// downsamplePoints returns at most maxPoints of the sorted points. Points
+// without a numeric value, the buckets left empty by fill null, are dropped
+// once the series has to be downsampled.
+func downsamplePoints(points []DataPoint, maxPoints int, method string) []DataPoint {
+
+	if len(points) <= maxPoints {
+
+		return points
+	}
+
+	numeric := make([]DataPoint, 0, len(points))
+
+	timestamps := make([]uint32, 0, len(points))
+
+	values := make([]float64, 0, len(points))
+
+	for _, point := range points {
+
+		if value, ok := convertToFloat64(point.Value); ok {
+
+			numeric = append(numeric, point)
+
+			timestamps = append(timestamps, point.Timestamp)
+
+			values = append(values, value)
+		}
+	}
+
+	if len(numeric) <= maxPoints {
+
+		return numeric
+	}
+
+	indexes := selectPoints(timestamps, values, maxPoints, method)
+
+	downsampled := make([]DataPoint, len(indexes))
+
+	for i, index := range indexes {
+
+		downsampled[i] = numeric[index]
+	}
+
+	return downsampled
+}
+
+// downsampleColumns returns at most maxPoints of the sorted numeric columns.
+func downsampleColumns(columns *Columns, maxPoints int, method string) *Columns {
+
+	if columns.Len() <= maxPoints {
+
+		return columns
+	}
+
+	values := make([]float64, columns.Len())
+
+	for i := range values {
+
+		values[i], _ = convertToFloat64(columns.Value(i))
+	}
+
+	indexes := selectPoints(columns.Timestamps, values, maxPoints, method)
+
+	downsampled := NewColumns(columns.Type, len(indexes))
+
+	for _, index := range indexes {
+
+		downsampled.AppendRow(columns, index)
+	}
+
+	return &downsampled
+}
+
+// selectPoints returns the indexes, in order, of the points kept out of more
+// than maxPoints sorted points.
+func selectPoints(timestamps []uint32, values []float64, maxPoints int, method string) []int {
+
+	if method == downsampleMinMax {
+
+		return selectMinMax(values, maxPoints)
+	}
+
+	return selectLTTB(timestamps, values, maxPoints)
+}
+
+// selectLTTB keeps the first and last point and, from each of maxPoints-2
+// buckets in between, the point forming the largest triangle with the point
+// kept before it and the average of the next bucket (Largest-Triangle-Three-
+// Buckets), so spikes survive while flat stretches are thinned out.
+func selectLTTB(timestamps []uint32, values []float64, maxPoints int) []int {
+
+	count := len(values)
+
+	every := float64(count-2) / float64(maxPoints-2)
+
+	indexes := make([]int, 0, maxPoints)
+
+	indexes = append(indexes, 0)
+
+	previous := 0
+
+	for bucket := 0; bucket < maxPoints-2; bucket++ {
+
+		nextStart, nextEnd := int(float64(bucket+1)*every)+1, min(int(float64(bucket+2)*every)+1, count)
+
+		averageX, averageY := 0.0, 0.0
+
+		for i := nextStart; i < nextEnd; i++ {
+
+			averageX += float64(timestamps[i])
+
+			averageY += values[i]
+		}
+
+		averageX /= float64(nextEnd - nextStart)
+
+		averageY /= float64(nextEnd - nextStart)
+
+		previousX, previousY := float64(timestamps[previous]), values[previous]
+
+		start, end := int(float64(bucket)*every)+1, int(float64(bucket+1)*every)+1
+
+		largest, selected := -1.0, start
+
+		for i := start; i < end; i++ {
+
+			area := math.Abs((previousX-averageX)*(values[i]-previousY) - (previousX-float64(timestamps[i]))*(averageY-previousY))
+
+			if area > largest {
+
+				largest, selected = area, i
+			}
+		}
+
+		indexes = append(indexes, selected)
+
+		previous = selected
+	}
+
+	return append(indexes, count-1)
+}
+
+// selectMinMax splits the points into maxPoints/2 buckets and keeps the
+// lowest and highest point of each, the envelope of the series.
+func selectMinMax(values []float64, maxPoints int) []int {
+
+	buckets := maxPoints / 2
+
+	every := float64(len(values)) / float64(buckets)
+
+	indexes := make([]int, 0, buckets*2)
+
+	for bucket := 0; bucket < buckets; bucket++ {
+
+		start, end := int(float64(bucket)*every), int(float64(bucket+1)*every)
+
+		if bucket == buckets-1 {
+
+			end = len(values)
+		}
+
+		if start >= end {
+
+			continue
+		}
+
+		low, high := start, start
+
+		for i := start + 1; i < end; i++ {
+
+			if values[i] < values[low] {
+
+				low = i
+			}
+
+			if values[i] > values[high] {
+
+				high = i
+			}
+		}
+
+		switch {
+
+		case low < high:
+
+			indexes = append(indexes, low, high)
+
+		case low > high:
+
+			indexes = append(indexes, high, low)
+
+		default:
+
+			indexes = append(indexes, low)
+		}
+	}
+
+	return indexes
+}
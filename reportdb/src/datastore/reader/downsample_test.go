@@ -0,0 +1,158 @@
+package reader
+
+import (
+	"reflect"
+	. "reportdb/utils"
+	"testing"
+)
+
+func TestGetDownsampleMethod(t *testing.T) {
+
+	tests := []struct {
+		name string
+
+		query Query
+
+		want string
+
+		code string
+	}{
+		{name: "lttb by default", query: Query{Type: queryTypeRaw, MaxPoints: 100}, want: downsampleLTTB},
+
+		{name: "minmax", query: Query{Type: queryTypeRaw, MaxPoints: 100, Downsample: "MinMax"}, want: downsampleMinMax},
+
+		{name: "numeric histogram", query: Query{Interval: 60, Aggregation: "AVG", MaxPoints: 100}, want: downsampleLTTB},
+
+		{name: "no max points", query: Query{Aggregation: "LAST"}, want: downsampleLTTB},
+
+		{name: "unknown method", query: Query{Type: queryTypeRaw, MaxPoints: 100, Downsample: "average"}, code: ErrInvalidQuery},
+
+		{name: "too few points", query: Query{Type: queryTypeRaw, MaxPoints: 2}, code: ErrInvalidQuery},
+
+		{name: "gauge", query: Query{Aggregation: "AVG", MaxPoints: 100}, code: ErrInvalidQuery},
+
+		{name: "string histogram", query: Query{Interval: 60, Aggregation: "MODE", MaxPoints: 100}, code: ErrInvalidQuery},
+	}
+
+	for _, test := range tests {
+
+		method, err := getDownsampleMethod(test.query)
+
+		if test.code != "" {
+
+			if GetErrorCode(err) != test.code {
+
+				t.Errorf("%s: error = %v, want code %s", test.name, err, test.code)
+			}
+
+			continue
+		}
+
+		if err != nil || method != test.want {
+
+			t.Errorf("%s: getDownsampleMethod = %q, %v, want %q", test.name, method, err, test.want)
+		}
+	}
+}
+
+func TestSelectLTTB(t *testing.T) {
+
+	timestamps := []uint32{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}
+
+	values := []float64{0, 0, 0, 10, 0, 0, 0, 0, -10, 0}
+
+	// the first and last point, and the spike and the dip of the two buckets
+	if got := selectLTTB(timestamps, values, 4); !reflect.DeepEqual(got, []int{0, 3, 8, 9}) {
+
+		t.Errorf("selectLTTB = %v, want [0 3 8 9]", got)
+	}
+
+	timestamps, values = make([]uint32, 1000), make([]float64, 1000)
+
+	for i := range timestamps {
+
+		timestamps[i] = uint32(i)
+	}
+
+	values[437] = 100
+
+	got := selectLTTB(timestamps, values, 50)
+
+	if len(got) != 50 || got[0] != 0 || got[49] != 999 {
+
+		t.Fatalf("selectLTTB kept %d points from %d to %d, want 50 from 0 to 999", len(got), got[0], got[len(got)-1])
+	}
+
+	spike := false
+
+	for i, index := range got {
+
+		if i > 0 && index <= got[i-1] {
+
+			t.Fatalf("selectLTTB indexes out of order: %v", got)
+		}
+
+		spike = spike || index == 437
+	}
+
+	if !spike {
+
+		t.Error("selectLTTB dropped the spike")
+	}
+}
+
+func TestSelectMinMax(t *testing.T) {
+
+	tests := []struct {
+		values []float64
+
+		maxPoints int
+
+		want []int
+	}{
+		{[]float64{5, 1, 9, 3, 2, 8, 4, 7}, 4, []int{1, 2, 4, 5}},
+
+		{[]float64{9, 1, 5, 3, 8, 2, 7, 4}, 4, []int{0, 1, 4, 5}},
+
+		{[]float64{3, 3, 3, 3}, 2, []int{0}}, // flat bucket
+
+		{[]float64{1, 2, 3, 4, 5, 6, 7}, 5, []int{0, 2, 3, 6}}, // the last bucket takes the remainder
+	}
+
+	for _, test := range tests {
+
+		if got := selectMinMax(test.values, test.maxPoints); !reflect.DeepEqual(got, test.want) {
+
+			t.Errorf("selectMinMax(%v, %d) = %v, want %v", test.values, test.maxPoints, got, test.want)
+		}
+	}
+}
+
+func TestDownsamplePoints(t *testing.T) {
+
+	points := []DataPoint{{Timestamp: 0, Value: 1.0}, {Timestamp: 10, Value: nil}, {Timestamp: 20, Value: 5.0}, {Timestamp: 30, Value: nil}, {Timestamp: 40, Value: 2.0}}
+
+	if got := downsamplePoints(points, 5, downsampleLTTB); !reflect.DeepEqual(got, points) {
+
+		t.Errorf("series within the limit changed: %v", got)
+	}
+
+	want := []DataPoint{{Timestamp: 0, Value: 1.0}, {Timestamp: 20, Value: 5.0}, {Timestamp: 40, Value: 2.0}}
+
+	if got := downsamplePoints(points, 3, downsampleLTTB); !reflect.DeepEqual(got, want) {
+
+		t.Errorf("downsamplePoints = %v, want the numeric points %v", got, want)
+	}
+
+	columns := NewColumns(TypeFloat64, 0)
+
+	for i := 0; i < 100; i++ {
+
+		columns.Append(uint32(i), float64(i%7))
+	}
+
+	if downsampled := downsampleColumns(&columns, 10, downsampleMinMax); downsampled.Len() > 10 {
+
+		t.Errorf("downsampleColumns kept %d points, want at most 10", downsampled.Len())
+	}
+}
@@ -0,0 +1,136 @@
+package reader
+
+import (
+	"math"
+	. "reportdb/utils"
+	"strconv"
+	"strings"
+)
+
+const (
+	fillNull = "null"
+
+	fillZero = "zero"
+
+	fillPrevious = "previous"
+
+	fillLinear = "linear"
+
+	fillConstant = "constant"
+)
+
+type fillPolicy struct {
+	mode string
+
+	constant float64
+}
+
+func parseFillPolicy(fill string) (fillPolicy, error) {
+
+	mode := strings.ToLower(strings.TrimSpace(fill))
+
+	switch mode {
+
+	case "":
+
+		return fillPolicy{mode: fillZero}, nil // keeps the old behaviour for clients that don't send a policy
+
+	case fillNull, fillZero, fillPrevious, fillLinear:
+
+		return fillPolicy{mode: mode}, nil
+	}
+
+	constant, err := strconv.ParseFloat(mode, 64)
+
+	if err != nil || math.IsNaN(constant) || math.IsInf(constant, 0) { // JSON can't encode them
+
+		return fillPolicy{}, NewQueryError(ErrInvalidQuery, "invalid fill policy %q", fill)
+	}
+
+	return fillPolicy{mode: fillConstant, constant: constant}, nil
+}
+
+// fillGaps replaces the nil values left by createBuckets for empty buckets.
+// Points must be sorted by timestamp.
+func fillGaps(points []DataPoint, policy fillPolicy) {
+
+	switch policy.mode {
+
+	case fillZero:
+
+		fillWith(points, float64(0))
+
+	case fillConstant:
+
+		fillWith(points, policy.constant)
+
+	case fillPrevious:
+
+		var previous interface{}
+
+		for i := range points {
+
+			if points[i].Value == nil {
+
+				points[i].Value = previous
+
+				continue
+			}
+
+			previous = points[i].Value
+		}
+
+	case fillLinear:
+
+		interpolateGaps(points)
+	}
+}
+
+func fillWith(points []DataPoint, value float64) {
+
+	for i := range points {
+
+		if points[i].Value == nil {
+
+			points[i].Value = value
+		}
+	}
+}
+
+// interpolateGaps interpolates gaps between two known values. Leading and trailing
+// gaps have only one neighbour and are left empty.
+func interpolateGaps(points []DataPoint) {
+
+	previous := -1
+
+	for i := range points {
+
+		if points[i].Value == nil {
+
+			continue
+		}
+
+		if previous >= 0 && i-previous > 1 {
+
+			startValue, startOk := convertToFloat64(points[previous].Value)
+
+			endValue, endOk := convertToFloat64(points[i].Value)
+
+			if startOk && endOk {
+
+				startTime := float64(points[previous].Timestamp)
+
+				span := float64(points[i].Timestamp) - startTime
+
+				for j := previous + 1; j < i; j++ {
+
+					ratio := (float64(points[j].Timestamp) - startTime) / span
+
+					points[j].Value = startValue + (endValue-startValue)*ratio
+				}
+			}
+		}
+
+		previous = i
+	}
+}
@@ -0,0 +1,101 @@
+package reader
+
+import (
+	"reflect"
+	. "reportdb/utils"
+	"testing"
+)
+
+func TestParseFillPolicy(t *testing.T) {
+
+	tests := []struct {
+		fill string
+
+		want fillPolicy
+
+		code string
+	}{
+		{fill: "", want: fillPolicy{mode: fillZero}},
+
+		{fill: " Previous ", want: fillPolicy{mode: fillPrevious}},
+
+		{fill: "linear", want: fillPolicy{mode: fillLinear}},
+
+		{fill: "-1.5", want: fillPolicy{mode: fillConstant, constant: -1.5}},
+
+		{fill: "NaN", code: ErrInvalidQuery},
+
+		{fill: "+Inf", code: ErrInvalidQuery},
+
+		{fill: "-infinity", code: ErrInvalidQuery},
+
+		{fill: "1e400", code: ErrInvalidQuery},
+
+		{fill: "nearest", code: ErrInvalidQuery},
+	}
+
+	for _, test := range tests {
+
+		policy, err := parseFillPolicy(test.fill)
+
+		if test.code != "" {
+
+			if GetErrorCode(err) != test.code {
+
+				t.Errorf("parseFillPolicy(%q) error = %v, want code %s", test.fill, err, test.code)
+			}
+
+			continue
+		}
+
+		if err != nil || policy != test.want {
+
+			t.Errorf("parseFillPolicy(%q) = %+v, %v, want %+v", test.fill, policy, err, test.want)
+		}
+	}
+}
+
+func TestFillGaps(t *testing.T) {
+
+	points := func(values ...interface{}) []DataPoint {
+
+		result := make([]DataPoint, len(values))
+
+		for i, value := range values {
+
+			result[i] = DataPoint{Timestamp: uint32(i * 10), Value: value}
+		}
+
+		return result
+	}
+
+	tests := []struct {
+		name string
+
+		policy fillPolicy
+
+		want []DataPoint
+	}{
+		{"null", fillPolicy{mode: fillNull}, points(nil, 1.0, nil, nil, 4.0, nil)},
+
+		{"zero", fillPolicy{mode: fillZero}, points(0.0, 1.0, 0.0, 0.0, 4.0, 0.0)},
+
+		{"constant", fillPolicy{mode: fillConstant, constant: -1}, points(-1.0, 1.0, -1.0, -1.0, 4.0, -1.0)},
+
+		{"previous", fillPolicy{mode: fillPrevious}, points(nil, 1.0, 1.0, 1.0, 4.0, 4.0)},
+
+		{"linear", fillPolicy{mode: fillLinear}, points(nil, 1.0, 2.0, 3.0, 4.0, nil)},
+	}
+
+	for _, test := range tests {
+
+		got := points(nil, 1.0, nil, nil, 4.0, nil)
+
+		fillGaps(got, test.policy)
+
+		if !reflect.DeepEqual(got, test.want) {
+
+			t.Errorf("%s: fillGaps = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
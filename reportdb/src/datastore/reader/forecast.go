@@ -0,0 +1,406 @@
+package reader
+
+import (
+	"math"
+	. "reportdb/utils"
+	"strings"
+)
+
+const (
+	queryTypeForecast = "forecast"
+
+	forecastLinear = "linear"
+
+	forecastHoltWinters = "holt_winters"
+
+	defaultForecastStep = 60 * 60
+
+	defaultForecastHorizon = 24 * 60 * 60
+
+	defaultForecastSeason = 24
+
+	defaultForecastAlpha = 0.3
+
+	defaultForecastBeta = 0.1
+
+	defaultForecastGamma = 0.1
+
+	maxForecastPoints = 10000
+)
+
+// forecastResult is the projection of one series. Crossing is the estimated
+// time the series reaches the threshold, nil when it is not expected to.
+type forecastResult struct {
+	Model string `json:"model"`
+
+	Points []DataPoint `json:"points"`
+
+	Crossing interface{} `json:"crossing"`
+}
+
+func getForecastOptions(query Query) (ForecastOptions, error) {
+
+	var options ForecastOptions
+
+	if query.Forecast != nil {
+
+		options = *query.Forecast
+	}
+
+	if query.CalendarInterval != "" {
+
+		return options, NewQueryError(ErrInvalidQuery, "forecast queries need a fixed interval")
+	}
+
+	options.Model = strings.ToLower(options.Model)
+
+	if options.Model == "" {
+
+		options.Model = forecastLinear
+	}
+
+	if options.Model != forecastLinear && options.Model != forecastHoltWinters {
+
+		return options, NewQueryError(ErrInvalidQuery, "invalid forecast model %q, expected linear or holt_winters", options.Model)
+	}
+
+	if options.Horizon == 0 {
+
+		options.Horizon = defaultForecastHorizon
+	}
+
+	if options.Season == 0 {
+
+		options.Season = defaultForecastSeason
+	}
+
+	if options.Alpha == 0 {
+
+		options.Alpha = defaultForecastAlpha
+	}
+
+	if options.Beta == 0 {
+
+		options.Beta = defaultForecastBeta
+	}
+
+	if options.Gamma == 0 {
+
+		options.Gamma = defaultForecastGamma
+	}
+
+	if options.Lookback < 0 || options.Horizon < 0 || options.Season < 2 {
+
+		return options, NewQueryError(ErrInvalidQuery, "invalid forecast options, lookback and horizon must be positive and season at least 2")
+	}
+
+	if options.Alpha > 1 || options.Beta > 1 || options.Gamma > 1 || options.Alpha < 0 || options.Beta < 0 || options.Gamma < 0 {
+
+		return options, NewQueryError(ErrInvalidQuery, "invalid forecast options, alpha, beta and gamma must be within 0 and 1")
+	}
+
+	if options.Horizon/getForecastStep(query) > maxForecastPoints {
+
+		return options, NewQueryError(ErrQueryTooLarge, "forecast projects more than %d points", maxForecastPoints)
+	}
+
+	return options, nil
+}
+
+func getForecastStep(query Query) int {
+
+	if query.Interval > 0 {
+
+		return query.Interval
+	}
+
+	return defaultForecastStep
+}
+
+// getForecastFrom returns the start of the window the models are fitted over.
+func getForecastFrom(query Query) (uint32, error) {
+
+	options, err := getForecastOptions(query)
+
+	if err != nil {
+
+		return 0, err
+	}
+
+	if options.Lookback == 0 {
+
+		return query.From, nil
+	}
+
+	return uint32(max(int64(query.To)-int64(options.Lookback), 0)), nil
+}
+
+// ForecastQuery buckets the lookback window, fits the model to the buckets of
+// every object (or of the merged series) and projects it horizon seconds past
+// query.To.
+func (reader *Reader) ForecastQuery(query Query, dataType DataType) (interface{}, error) {
+
+	if dataType == TypeString {
+
+		return nil, NewQueryError(ErrInvalidQuery, "forecast queries need a numeric counter")
+	}
+
+	options, err := getForecastOptions(query)
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	aggregation := strings.ToUpper(query.Aggregation)
+
+	switch aggregation {
+
+	case "":
+
+		aggregation = "AVG"
+
+	case "AVG", "MIN", "MAX", "SUM":
+
+	default:
+
+		return nil, NewQueryError(ErrInvalidQuery, "forecast queries need a numeric aggregation, got %q", query.Aggregation)
+	}
+
+	fitQuery := query
+
+	fitQuery.Interval = getForecastStep(query)
+
+	if fitQuery.From, err = getForecastFrom(query); err != nil {
+
+		return nil, err
+	}
+
+	starts, err := getBucketStarts(fitQuery)
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	bucketed := reader.bucketData(starts, fitQuery.From, query.To, aggregation)
+
+	if query.GroupByObjects {
+
+		result := make(map[uint32]forecastResult, len(bucketed))
+
+		for objectID, points := range bucketed {
+
+			result[objectID] = getForecast(points, fitQuery.Interval, options)
+		}
+
+		return result, nil
+	}
+
+	return getForecast(reader.mergeAllObjects(bucketed, aggregation), fitQuery.Interval, options), nil
+}
+
+// getForecast fits the buckets of one series. Gaps are interpolated before
+// fitting and leading and trailing empty buckets are left out.
+func getForecast(points []DataPoint, step int, options ForecastOptions) forecastResult {
+
+	interpolateGaps(points)
+
+	var times, values []float64
+
+	for _, point := range points {
+
+		if value, ok := convertToFloat64(point.Value); ok {
+
+			times = append(times, float64(point.Timestamp))
+
+			values = append(values, value)
+		}
+	}
+
+	result := forecastResult{
+
+		Model: options.Model,
+
+		Points: []DataPoint{},
+	}
+
+	if len(values) < 2 {
+
+		return result // nothing to fit a trend to
+	}
+
+	last := times[len(times)-1]
+
+	lastBucket := points[len(points)-1].Timestamp // projections start after the bucket holding To
+
+	skipped := int(float64(lastBucket)-last) / step // trailing empty buckets
+
+	first := int(times[0]-float64(points[0].Timestamp)) / step // leading empty buckets
+
+	steps := options.Horizon / step
+
+	var projected []float64
+
+	if options.Model == forecastLinear {
+
+		slope, intercept := fitLinear(times, values)
+
+		for i := 1; i <= steps; i++ {
+
+			projected = append(projected, intercept+slope*float64(lastBucket+uint32(i*step)))
+		}
+
+		if options.Threshold != nil && slope != 0 {
+
+			// solved exactly, so the crossing may lie beyond the horizon
+			crossing := (*options.Threshold - intercept) / slope
+
+			if crossing > last && crossing <= math.MaxUint32 {
+
+				result.Crossing = uint32(crossing)
+			}
+		}
+
+	} else {
+
+		projected = fitHoltWinters(values, first, skipped+steps, options)[skipped:]
+
+		if options.Threshold != nil {
+
+			threshold := *options.Threshold
+
+			rising := values[len(values)-1] < threshold
+
+			for i, value := range projected {
+
+				if (rising && value >= threshold) || (!rising && value <= threshold) {
+
+					result.Crossing = lastBucket + uint32((i+1)*step)
+
+					break
+				}
+			}
+		}
+	}
+
+	for i, value := range projected {
+
+		result.Points = append(result.Points, DataPoint{
+
+			Timestamp: lastBucket + uint32((i+1)*step),
+
+			Value: value,
+		})
+	}
+
+	return result
+}
+
+// fitLinear returns the least squares line through the points. Times are
+// shifted to the first point to keep the sums small.
+func fitLinear(times []float64, values []float64) (float64, float64) {
+
+	origin := times[0]
+
+	var sumT, sumV, sumTT, sumTV float64
+
+	for i := range times {
+
+		t := times[i] - origin
+
+		sumT += t
+
+		sumV += values[i]
+
+		sumTT += t * t
+
+		sumTV += t * values[i]
+	}
+
+	n := float64(len(times))
+
+	denominator := n*sumTT - sumT*sumT
+
+	if denominator == 0 {
+
+		return 0, sumV / n
+	}
+
+	slope := (n*sumTV - sumT*sumV) / denominator
+
+	intercept := (sumV - slope*sumT) / n
+
+	return slope, intercept - slope*origin
+}
+
+// fitHoltWinters runs additive Holt-Winters over values, whose first one is
+// the bucket at position first of the window, and returns the next steps
+// values. Seasonal slots follow the bucket positions, so leading empty buckets
+// don't shift the phase. With less than two seasons of data the seasonal
+// component can't be initialised and it falls back to Holt's linear trend.
+func fitHoltWinters(values []float64, first int, steps int, options ForecastOptions) []float64 {
+
+	season := options.Season
+
+	if len(values) < 2*season {
+
+		season = 1
+	}
+
+	seasonal := make([]float64, season)
+
+	level, trend := values[0], values[1]-values[0]
+
+	start := 1
+
+	if season > 1 {
+
+		var firstSum, secondSum float64
+
+		for i := 0; i < season; i++ {
+
+			firstSum += values[i]
+
+			secondSum += values[season+i]
+		}
+
+		level = firstSum / float64(season)
+
+		trend = (secondSum - firstSum) / float64(season*season)
+
+		for i := 0; i < season; i++ {
+
+			seasonal[(first+i)%season] = values[i] - level
+		}
+
+		start = 0
+	}
+
+	for t := start; t < len(values); t++ {
+
+		slot := (first + t) % season
+
+		s := seasonal[slot]
+
+		previousLevel := level
+
+		level = options.Alpha*(values[t]-s) + (1-options.Alpha)*(level+trend)
+
+		trend = options.Beta*(level-previousLevel) + (1-options.Beta)*trend
+
+		if season > 1 {
+
+			seasonal[slot] = options.Gamma*(values[t]-level) + (1-options.Gamma)*s
+		}
+	}
+
+	projected := make([]float64, steps)
+
+	for h := 1; h <= steps; h++ {
+
+		projected[h-1] = level + float64(h)*trend + seasonal[(first+len(values)+h-1)%season]
+	}
+
+	return projected
+}
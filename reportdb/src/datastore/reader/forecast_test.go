@@ -0,0 +1,118 @@
+package reader
+
+import (
+	"math"
+	. "reportdb/utils"
+	"testing"
+)
+
+var forecastSeason = []float64{0, 10, 0, -10}
+
+// seasonalValue is the value of the test series at a bucket position.
+func seasonalValue(position int) float64 {
+
+	return 100 + forecastSeason[position%len(forecastSeason)]
+}
+
+func TestFitHoltWinters(t *testing.T) {
+
+	seasonal := func(first int, count int) []float64 {
+
+		values := make([]float64, count)
+
+		for i := range values {
+
+			values[i] = seasonalValue(first + i)
+		}
+
+		return values
+	}
+
+	options := ForecastOptions{Season: 4, Alpha: 0.3, Beta: 0.1, Gamma: 0.1}
+
+	tests := []struct {
+		name string
+
+		values []float64
+
+		first int
+
+		want []float64
+	}{
+		{"three seasons", seasonal(0, 12), 0, []float64{100, 110, 100, 90}},
+
+		{"starting in the second slot", seasonal(1, 12), 1, []float64{110, 100, 90, 100}},
+
+		{"starting in the last slot", seasonal(3, 9), 3, []float64{100, 110, 100, 90}},
+
+		{"less than two seasons", []float64{1, 2, 3, 4, 5}, 0, []float64{6, 7, 8, 9}},
+	}
+
+	for _, test := range tests {
+
+		got := fitHoltWinters(test.values, test.first, len(test.want), options)
+
+		for i := range test.want {
+
+			if math.Abs(got[i]-test.want[i]) > 1e-9 {
+
+				t.Errorf("%s: fitHoltWinters = %v, want %v", test.name, got, test.want)
+
+				break
+			}
+		}
+	}
+}
+
+func TestGetForecastSeasonalPhase(t *testing.T) {
+
+	const step = 60
+
+	tests := []struct {
+		name string
+
+		leading, trailing int // empty buckets
+	}{
+		{"no gaps", 0, 0},
+
+		{"leading gap", 2, 0},
+
+		{"leading and trailing gaps", 1, 2},
+	}
+
+	for _, test := range tests {
+
+		var points []DataPoint
+
+		for position := 0; position < test.leading+12+test.trailing; position++ {
+
+			point := DataPoint{Timestamp: uint32(position * step)}
+
+			if position >= test.leading && position < test.leading+12 {
+
+				point.Value = seasonalValue(position)
+			}
+
+			points = append(points, point)
+		}
+
+		options := ForecastOptions{Model: forecastHoltWinters, Horizon: 8 * step, Season: 4, Alpha: 0.3, Beta: 0.1, Gamma: 0.1}
+
+		result := getForecast(points, step, options)
+
+		if len(result.Points) != 8 {
+
+			t.Fatalf("%s: %d projected points, want 8", test.name, len(result.Points))
+		}
+
+		for _, point := range result.Points {
+
+			want := seasonalValue(int(point.Timestamp) / step)
+
+			if math.Abs(point.Value.(float64)-want) > 1e-9 {
+
+				t.Errorf("%s: projection at %d = %v, want %v", test.name, point.Timestamp, point.Value, want)
+			}
+		}
+	}
+}
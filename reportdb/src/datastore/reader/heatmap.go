@@ -0,0 +1,278 @@
+package reader
+
+import (
+	"math"
+	. "reportdb/utils"
+	"sort"
+	"strings"
+)
+
+const (
+	queryTypeHeatmap = "heatmap"
+
+	heatmapLinear = "linear"
+
+	heatmapExponential = "exponential"
+
+	defaultHeatmapBins = 10
+
+	maxHeatmapBins = 1000
+)
+
+// heatmapResult is the distribution of the values of every object over time,
+// Counts[i][j] samples of the bucket starting at Timestamps[i] fell into the
+// bin between Bins[j] and Bins[j+1].
+type heatmapResult struct {
+	Timestamps []uint32 `json:"timestamps"`
+
+	Bins []float64 `json:"bins"` // edges of the value bins, one more than bins
+
+	Counts [][]int `json:"counts"` // [time bucket][value bin]
+}
+
+func getHeatmapOptions(query Query) (HeatmapOptions, error) {
+
+	var options HeatmapOptions
+
+	if query.Heatmap != nil {
+
+		options = *query.Heatmap
+	}
+
+	if !isHistogram(query) {
+
+		return options, NewQueryError(ErrInvalidQuery, "heatmap queries need an interval or calendar_interval")
+	}
+
+	if aggregation := strings.ToUpper(query.Aggregation); aggregation != "" && !isNumericAggregation(aggregation) {
+
+		return options, NewQueryError(ErrInvalidQuery, "heatmap queries take no aggregation or avg, min, max or sum, got %q", query.Aggregation)
+	}
+
+	options.Scale = strings.ToLower(options.Scale)
+
+	if options.Scale == "" {
+
+		options.Scale = heatmapLinear
+	}
+
+	if options.Scale != heatmapLinear && options.Scale != heatmapExponential {
+
+		return options, NewQueryError(ErrInvalidQuery, "invalid heatmap scale %q, expected linear or exponential", options.Scale)
+	}
+
+	if options.Bins == 0 {
+
+		options.Bins = defaultHeatmapBins
+	}
+
+	if options.Bins < 0 || options.Bins > maxHeatmapBins {
+
+		return options, NewQueryError(ErrInvalidQuery, "heatmap bins must be between 1 and %d", maxHeatmapBins)
+	}
+
+	if options.Max < options.Min {
+
+		return options, NewQueryError(ErrInvalidQuery, "heatmap max %v is below min %v", options.Max, options.Min)
+	}
+
+	if options.Scale == heatmapExponential && options.Max != 0 && options.Min <= 0 {
+
+		return options, NewQueryError(ErrInvalidQuery, "exponential heatmap bins need a positive min")
+	}
+
+	return options, nil
+}
+
+// HeatmapQuery counts the values of all objects into value bins for every
+// time bucket. Without an aggregation every sample is counted, with one every
+// object is counted once per bucket with its aggregate, so the matrix shows
+// how the fleet is spread rather than how often objects report.
+func (reader *Reader) HeatmapQuery(query Query, dataType DataType) (interface{}, error) {
+
+	if dataType == TypeString {
+
+		return nil, NewQueryError(ErrInvalidQuery, "heatmap queries need a numeric counter")
+	}
+
+	options, err := getHeatmapOptions(query)
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	starts, err := getBucketStarts(query)
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	visit := reader.getHeatmapSamples(query, starts)
+
+	if options.Min == 0 && options.Max == 0 {
+
+		options.Min, options.Max = getHeatmapRange(visit, options.Scale)
+	}
+
+	edges := getHeatmapEdges(options)
+
+	result := heatmapResult{
+
+		Timestamps: starts,
+
+		Bins: edges,
+
+		Counts: make([][]int, len(starts)),
+	}
+
+	for i := range result.Counts {
+
+		result.Counts[i] = make([]int, options.Bins)
+	}
+
+	visit(func(bucket int, value float64) {
+
+		result.Counts[bucket][getHeatmapBin(value, options)]++
+	})
+
+	return result, nil
+}
+
+// getHeatmapSamples returns a function passing every sample of the range, with
+// the index of its time bucket, to a visitor.
+func (reader *Reader) getHeatmapSamples(query Query, starts []uint32) func(visitor func(bucket int, value float64)) {
+
+	if aggregation := strings.ToUpper(query.Aggregation); aggregation != "" {
+
+		bucketed := reader.bucketData(starts, query.From, query.To, aggregation)
+
+		return func(visitor func(bucket int, value float64)) {
+
+			for _, points := range bucketed {
+
+				for bucket, point := range points {
+
+					if value, ok := convertToFloat64(point.Value); ok { // empty buckets are nil
+
+						visitor(bucket, value)
+					}
+				}
+			}
+		}
+	}
+
+	return func(visitor func(bucket int, value float64)) {
+
+		for _, points := range reader.results {
+
+			for i, timestamp := range points.Timestamps {
+
+				if timestamp < query.From || timestamp > query.To {
+
+					continue
+				}
+
+				bucket := sort.Search(len(starts), func(i int) bool {
+
+					return starts[i] > timestamp
+				}) - 1
+
+				if bucket < 0 {
+
+					continue
+				}
+
+				value, _ := convertToFloat64(points.Value(i))
+
+				visitor(bucket, value)
+			}
+		}
+	}
+}
+
+// getHeatmapRange returns the lowest and highest sample, the lowest positive
+// one for exponential bins.
+func getHeatmapRange(visit func(visitor func(bucket int, value float64)), scale string) (float64, float64) {
+
+	low, high := math.Inf(1), math.Inf(-1)
+
+	visit(func(_ int, value float64) {
+
+		if scale == heatmapExponential && value <= 0 {
+
+			return
+		}
+
+		low, high = min(low, value), max(high, value)
+	})
+
+	if math.IsInf(low, 1) {
+
+		return 1, 1 // no samples, the bins only need valid edges
+	}
+
+	return low, high
+}
+
+func getHeatmapEdges(options HeatmapOptions) []float64 {
+
+	if options.Max == options.Min { // a constant series still gets bins of some width
+
+		options.Max = options.Min + 1
+
+		if options.Scale == heatmapExponential {
+
+			options.Max = options.Min * 2
+		}
+	}
+
+	edges := make([]float64, options.Bins+1)
+
+	for i := range edges {
+
+		fraction := float64(i) / float64(options.Bins)
+
+		if options.Scale == heatmapExponential {
+
+			edges[i] = options.Min * math.Pow(options.Max/options.Min, fraction)
+
+		} else {
+
+			edges[i] = options.Min + (options.Max-options.Min)*fraction
+		}
+	}
+
+	edges[options.Bins] = options.Max // no rounding error on the last edge
+
+	return edges
+}
+
+// getHeatmapBin returns the bin of a value, values outside the edges are
+// counted in the first or last bin.
+func getHeatmapBin(value float64, options HeatmapOptions) int {
+
+	if options.Max == options.Min {
+
+		return 0
+	}
+
+	var fraction float64
+
+	if options.Scale == heatmapExponential {
+
+		if value <= 0 {
+
+			return 0
+		}
+
+		fraction = math.Log(value/options.Min) / math.Log(options.Max/options.Min)
+
+	} else {
+
+		fraction = (value - options.Min) / (options.Max - options.Min)
+	}
+
+	return min(max(int(fraction*float64(options.Bins)), 0), options.Bins-1)
+}
@@ -0,0 +1,206 @@
+package reader
+
+import (
+	"math"
+	"reflect"
+	. "reportdb/utils"
+	"testing"
+)
+
+func TestGetHeatmapEdges(t *testing.T) {
+
+	tests := []struct {
+		name string
+
+		options HeatmapOptions
+
+		want []float64
+	}{
+		{"linear", HeatmapOptions{Scale: heatmapLinear, Bins: 5, Min: 0, Max: 10}, []float64{0, 2, 4, 6, 8, 10}},
+
+		{"exponential", HeatmapOptions{Scale: heatmapExponential, Bins: 3, Min: 1, Max: 1000}, []float64{1, 10, 100, 1000}},
+
+		{"constant linear", HeatmapOptions{Scale: heatmapLinear, Bins: 2, Min: 4, Max: 4}, []float64{4, 4.5, 5}},
+
+		{"constant exponential", HeatmapOptions{Scale: heatmapExponential, Bins: 2, Min: 4, Max: 4}, []float64{4, 4 * math.Sqrt2, 8}},
+	}
+
+	for _, test := range tests {
+
+		got := getHeatmapEdges(test.options)
+
+		if len(got) != len(test.want) {
+
+			t.Errorf("%s: getHeatmapEdges = %v, want %v", test.name, got, test.want)
+
+			continue
+		}
+
+		for i := range got {
+
+			if math.Abs(got[i]-test.want[i]) > 1e-9 {
+
+				t.Errorf("%s: getHeatmapEdges = %v, want %v", test.name, got, test.want)
+
+				break
+			}
+		}
+	}
+}
+
+func TestGetHeatmapBin(t *testing.T) {
+
+	linear := HeatmapOptions{Scale: heatmapLinear, Bins: 5, Min: 0, Max: 10}
+
+	exponential := HeatmapOptions{Scale: heatmapExponential, Bins: 3, Min: 1, Max: 1000}
+
+	tests := []struct {
+		options HeatmapOptions
+
+		value float64
+
+		want int
+	}{
+		{linear, 0, 0},
+
+		{linear, 1.99, 0},
+
+		{linear, 2, 1},
+
+		{linear, 9.99, 4},
+
+		{linear, 10, 4}, // the last edge belongs to the last bin
+
+		{linear, -5, 0},
+
+		{linear, 50, 4},
+
+		{exponential, 5, 0},
+
+		{exponential, 50, 1},
+
+		{exponential, 500, 2},
+
+		{exponential, 0, 0},
+
+		{exponential, -1, 0},
+	}
+
+	for _, test := range tests {
+
+		if got := getHeatmapBin(test.value, test.options); got != test.want {
+
+			t.Errorf("getHeatmapBin(%v, %s) = %d, want %d", test.value, test.options.Scale, got, test.want)
+		}
+	}
+}
+
+func TestGetHeatmapOptions(t *testing.T) {
+
+	tests := []struct {
+		name string
+
+		query Query
+
+		code string
+	}{
+		{"defaults", Query{Interval: 60}, ""},
+
+		{"aggregated", Query{Interval: 60, Aggregation: "avg"}, ""},
+
+		{"no interval", Query{}, ErrInvalidQuery},
+
+		{"string aggregation", Query{Interval: 60, Aggregation: "MODE"}, ErrInvalidQuery},
+
+		{"unknown scale", Query{Interval: 60, Heatmap: &HeatmapOptions{Scale: "log"}}, ErrInvalidQuery},
+
+		{"too many bins", Query{Interval: 60, Heatmap: &HeatmapOptions{Bins: maxHeatmapBins + 1}}, ErrInvalidQuery},
+
+		{"max below min", Query{Interval: 60, Heatmap: &HeatmapOptions{Min: 5, Max: 1}}, ErrInvalidQuery},
+
+		{"exponential from zero", Query{Interval: 60, Heatmap: &HeatmapOptions{Scale: "exponential", Max: 10}}, ErrInvalidQuery},
+	}
+
+	for _, test := range tests {
+
+		options, err := getHeatmapOptions(test.query)
+
+		if test.code != "" {
+
+			if GetErrorCode(err) != test.code {
+
+				t.Errorf("%s: error = %v, want code %s", test.name, err, test.code)
+			}
+
+			continue
+		}
+
+		if err != nil || options.Bins != defaultHeatmapBins || options.Scale != heatmapLinear {
+
+			t.Errorf("%s: options = %+v, %v, want %d linear bins", test.name, options, err, defaultHeatmapBins)
+		}
+	}
+}
+
+func TestHeatmapQuery(t *testing.T) {
+
+	reader := newReader(nil)
+
+	add := func(objectID uint32, timestamps []uint32, values []float64) {
+
+		columns := NewColumns(TypeFloat64, len(values))
+
+		for i := range values {
+
+			columns.Append(timestamps[i], values[i])
+		}
+
+		reader.results[objectID] = &columns
+	}
+
+	add(1, []uint32{0, 5, 10}, []float64{1, 9, 5})
+
+	add(2, []uint32{0, 15}, []float64{3, 7})
+
+	tests := []struct {
+		name string
+
+		aggregation string
+
+		options *HeatmapOptions
+
+		bins []float64
+
+		counts [][]int
+	}{
+		{"every sample", "", &HeatmapOptions{Bins: 2, Max: 10}, []float64{0, 5, 10}, [][]int{{2, 1}, {0, 2}}},
+
+		{"one aggregate per object", "avg", &HeatmapOptions{Bins: 2, Max: 10}, []float64{0, 5, 10}, [][]int{{1, 1}, {0, 2}}},
+
+		{"range of the samples", "", &HeatmapOptions{Bins: 2}, []float64{1, 5, 9}, [][]int{{2, 1}, {0, 2}}},
+	}
+
+	for _, test := range tests {
+
+		query := Query{From: 0, To: 19, Interval: 10, Aggregation: test.aggregation, Heatmap: test.options}
+
+		data, err := reader.HeatmapQuery(query, TypeFloat64)
+
+		if err != nil {
+
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		result := data.(heatmapResult)
+
+		if !reflect.DeepEqual(result.Timestamps, []uint32{0, 10}) || !reflect.DeepEqual(result.Bins, test.bins) || !reflect.DeepEqual(result.Counts, test.counts) {
+
+			t.Errorf("%s: HeatmapQuery = %+v, want bins %v and counts %v", test.name, result, test.bins, test.counts)
+		}
+	}
+
+	if _, err := reader.HeatmapQuery(Query{From: 0, To: 19, Interval: 10}, TypeString); GetErrorCode(err) != ErrInvalidQuery {
+
+		t.Errorf("string counter: error = %v, want code %s", err, ErrInvalidQuery)
+	}
+}
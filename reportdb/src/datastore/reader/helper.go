@@ -3,7 +3,6 @@ package reader
 import (
 	"context"
 	"encoding/binary"
-	"fmt"
 	"go.uber.org/zap"
 	"math"
 	. "reportdb/cache"
@@ -11,30 +10,260 @@ import (
 	. "reportdb/storage"
 	. "reportdb/utils"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+type dayPlan struct {
+	day int
+
+	path string
+
+	store *StoreEngine
+
+	objects []uint32
+}
+
+// pointsBudget cancels the object workers of a query as soon as the points
+// they fetched exceed the limit, instead of after every day is decoded.
+type pointsBudget struct {
+	max int64
+
+	fetched atomic.Int64
+
+	cancel context.CancelCauseFunc
+}
+
+func (budget *pointsBudget) spend(points int) {
+
+	if budget.max > 0 && budget.fetched.Add(int64(points)) > budget.max {
+
+		budget.cancel(NewQueryError(ErrQueryTooLarge, "query returns more than %d points", budget.max))
+	}
+}
+
+// getMaxPoints returns the points limit of query. Raw queries are exempt,
+// they return one page of the range at a time however many points it holds.
+func getMaxPoints(query Query) int {
+
+	if query.Type == queryTypeRaw {
+
+		return 0
+	}
+
+	return GetMaxQueryPoints()
+}
+
 func (reader *Reader) FetchData(query Query) error {
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*time.Duration(GetQueryTimeout()))
 
 	defer cancel()
 
-	fromTime, toTime := getTimeBounds(query.From, query.To)
+	if query.From > query.To {
+
+		return NewQueryError(ErrInvalidQuery, "from %d is after to %d", query.From, query.To)
+	}
+
+	if err := validateQueryType(query); err != nil {
+
+		return err
+	}
 
 	dataType, err := GetCounterType(query.CounterID)
 
 	if err != nil {
 
-		return fmt.Errorf("reader.fetchData error : %v", err)
+		return NewQueryError(ErrInvalidQuery, "reader.fetchData error : %v", err)
 	}
 
-	workingDirectory := GetWorkingDirectory()
+	if query.MaxPoints > 0 && dataType == TypeString {
+
+		return NewQueryError(ErrInvalidQuery, "max_points needs a numeric counter")
+	}
+
+	if query.Window != nil && dataType == TypeString {
+
+		return NewQueryError(ErrInvalidQuery, "window functions need a numeric counter")
+	}
+
+	if strings.Contains(query.Aggregation, ",") && dataType == TypeString {
+
+		return NewQueryError(ErrInvalidQuery, "aggregation lists need a numeric counter")
+	}
+
+	if query.From, err = getFetchFrom(query); err != nil {
+
+		return err
+	}
+
+	planStarted := time.Now()
+
+	plans, err := reader.planQuery(ctx, query)
+
+	reader.stats.PlanTime = time.Since(planStarted).Nanoseconds()
+
+	if err != nil {
+
+		return err
+	}
+
+	if err = reader.checkQueryCost(query, plans); err != nil {
+
+		return err
+	}
+
+	fetchStarted := time.Now()
+
+	for k := range reader.fetched {
+
+		delete(reader.fetched, k)
+	}
+
+	for k := range reader.results {
+
+		delete(reader.results, k)
+	}
+
+	for k := range reader.aggregates {
+
+		delete(reader.aggregates, k)
+	}
+
+	fetchCtx, cancelFetch := context.WithCancelCause(ctx)
+
+	defer cancelFetch(nil)
+
+	budget := &pointsBudget{max: int64(getMaxPoints(query)), cancel: cancelFetch}
+
+	if canStream(query, dataType, int(reader.stats.Days)) {
+
+		reader.stats.Streamed = true
+
+		err = reader.streamData(fetchCtx, query, dataType, plans, budget)
+
+		reader.stats.FetchTime = time.Since(fetchStarted).Nanoseconds()
+
+		if cause := context.Cause(fetchCtx); GetErrorCode(cause) == ErrQueryTooLarge {
+
+			return cause
+		}
+
+		if ctx.Err() != nil {
+
+			return NewQueryError(ErrQueryTimeout, "query exceeded the timeout of %d seconds", GetQueryTimeout())
+		}
+
+		if err == nil && len(reader.aggregates) == 0 {
+
+			return NewQueryError(ErrNoData, "no data found in time range %d-%d", query.From, query.To)
+		}
+
+		return err
+	}
 
 	wg := &sync.WaitGroup{}
 
-	for current := fromTime; !current.After(toTime); current = current.AddDate(0, 0, 1) {
+	for _, plan := range plans {
+
+		reader.fetchForObjectIDs(fetchCtx, wg, plan, dataType, query, budget)
+	}
+
+	// object workers stop scanning once ctx is done, so waiting here is
+	// bounded and nothing keeps running after the query has returned
+	wg.Wait()
+
+	reader.stats.FetchTime = time.Since(fetchStarted).Nanoseconds()
+
+	if cause := context.Cause(fetchCtx); GetErrorCode(cause) == ErrQueryTooLarge {
+
+		return cause
+	}
+
+	if ctx.Err() != nil {
+
+		return NewQueryError(ErrQueryTimeout, "query exceeded the timeout of %d seconds", GetQueryTimeout())
+	}
+
+	mergeStarted := time.Now()
+
+	err = reader.mergeResults(query, dataType)
+
+	reader.stats.MergeTime = time.Since(mergeStarted).Nanoseconds()
+
+	if err != nil {
+
+		return err
+	}
+
+	if len(reader.results) == 0 {
+
+		return NewQueryError(ErrNoData, "no data found in time range %d-%d", query.From, query.To)
+	}
+
+	return nil
+}
+
+// planQuery resolves the engine and the objects to read for every day of the
+// query. Objects come from the object registry, and days an object has no data
+// for are left out, so days without any data are never opened.
+func (reader *Reader) planQuery(ctx context.Context, query Query) ([]dayPlan, error) {
+
+	fromTime, toTime := getTimeBounds(query.From, query.To)
+
+	if maxDays := GetMaxQueryDays(); maxDays > 0 {
+
+		if days := int(toTime.Sub(fromTime).Hours()/24) + 1; days > maxDays {
+
+			return nil, NewQueryError(ErrQueryTooLarge, "query spans %d days, the limit is %d", days, maxDays)
+		}
+	}
+
+	registry := reader.storePool.GetRegistry()
+
+	objects := query.ObjectIDs
+
+	if len(objects) == 0 {
+
+		objects = registry.GetObjects(query.CounterID, query.From, query.To)
+	}
+
+	workingDirectory := GetWorkingDirectory()
+
+	var plans []dayPlan
+
+	day := 0
+
+	// days are stepped in absolute time, the way writers derive day paths
+	for current := fromTime; !current.After(toTime); current, day = current.Add(24*time.Hour), day+1 {
+
+		if ctx.Err() != nil {
+
+			return nil, NewQueryError(ErrQueryTimeout, "query exceeded the timeout of %d seconds", GetQueryTimeout())
+		}
+
+		reader.stats.Days++
+
+		dayFrom := max(query.From, uint32(current.Unix()))
+
+		dayTo := min(query.To, uint32(current.Unix())+24*60*60-1)
+
+		var dayObjects []uint32
+
+		for _, objectID := range objects {
+
+			if registry.HasData(query.CounterID, objectID, dayFrom, dayTo) {
+
+				dayObjects = append(dayObjects, objectID)
+			}
+		}
+
+		if len(dayObjects) == 0 {
+
+			continue
+		}
 
 		path, store, err := reader.getStorePathAndEngine(current, query.CounterID, workingDirectory)
 
@@ -43,45 +272,61 @@ func (reader *Reader) FetchData(query Query) error {
 			continue
 		}
 
-		if len(query.ObjectIDs) == 0 {
+		reader.stats.EnginesOpened++
 
-			var objects []uint32
+		plans = append(plans, dayPlan{
 
-			if _, exits := reader.objectsMapping[path]; exits {
+			day: day,
 
-				objects = reader.objectsMapping[path]
+			path: path,
 
-			} else {
+			store: store,
 
-				objects, err = store.GetKeys()
+			objects: dayObjects,
+		})
+	}
 
-				if err != nil {
+	return plans, nil
+}
 
-					return fmt.Errorf("GetKeys : %v", err)
-				}
+// checkQueryCost rejects a query before any data is read when it touches more
+// objects, or more object-days, than allowed.
+func (reader *Reader) checkQueryCost(query Query, plans []dayPlan) error {
 
-				reader.objectsMapping[path] = objects
-			}
+	objects := len(query.ObjectIDs)
+
+	cost := 0
+
+	if objects == 0 {
 
-			reader.fetchForObjectIDs(ctx, wg, path, store, query, dataType, objects)
+		distinct := make(map[uint32]struct{})
 
-		} else {
+		for _, plan := range plans {
 
-			reader.fetchForObjectIDs(ctx, wg, path, store, query, dataType, nil)
+			for _, objectID := range plan.objects {
+
+				distinct[objectID] = struct{}{}
+			}
 		}
 
+		objects = len(distinct)
 	}
 
-	if err = reader.waitWithContext(ctx, wg); err != nil {
+	for _, plan := range plans {
 
-		return err
+		cost += len(plan.objects)
 	}
 
-	reader.mergeResults(query, fromTime, toTime, workingDirectory)
+	reader.stats.Objects = int64(objects)
 
-	if len(reader.results) == 0 {
+	if maxObjects := GetMaxQueryObjects(); maxObjects > 0 && objects > maxObjects {
+
+		return NewQueryError(ErrQueryTooLarge, "query touches %d objects, the limit is %d", objects, maxObjects)
+	}
 
-		return fmt.Errorf("no data found in time range %d-%d", query.From, query.To)
+	if maxCost := GetMaxQueryCost(); maxCost > 0 && cost > maxCost {
+
+		return NewQueryError(ErrQueryTooLarge, "query touches %d object days, the limit is %d", cost, maxCost)
 	}
 
 	return nil
@@ -109,22 +354,12 @@ func (reader *Reader) getStorePathAndEngine(current time.Time, counterID uint16,
 	return path, store, nil
 }
 
-func (reader *Reader) fetchForObjectIDs(ctx context.Context, wg *sync.WaitGroup, path string, store *StoreEngine, query Query, dataType DataType, objects []uint32) {
-
-	var objectIds []uint32
-
-	if len(objects) > 0 {
+// fetchForObjectIDs loads the whole day of every object, from the cache when
+// possible, and keeps the series at fetched[objectID][day] for mergeResults.
+// Points within the query range are charged to budget as each day arrives.
+func (reader *Reader) fetchForObjectIDs(ctx context.Context, wg *sync.WaitGroup, plan dayPlan, dataType DataType, query Query, budget *pointsBudget) {
 
-		objectIds = objects
-
-	} else {
-
-		objectIds = query.ObjectIDs
-	}
-
-	cache := GetCache()
-
-	for _, objectID := range objectIds {
+	for _, objectID := range plan.objects {
 
 		select {
 
@@ -145,105 +380,105 @@ func (reader *Reader) fetchForObjectIDs(ctx context.Context, wg *sync.WaitGroup,
 					reader.objectPool <- struct{}{}
 				}()
 
-				cacheKey := path + "_" + strconv.FormatUint(uint64(objectID), 10)
+				series, hit, err := LoadSeries(plan.path, objectID, func() (Columns, error) {
 
-				if _, found := cache.Get(cacheKey); found && !reader.storePool.CheckEngineUsedPut(path) {
+					result, err := plan.store.Get(ctx, objectID, 0, math.MaxUint32, reader.stats)
 
-					return
-				}
+					if err != nil {
 
-				result, err := store.Get(objectID, query.From, query.To)
+						return Columns{}, err
+					}
 
-				if err != nil {
+					columns := NewColumns(dataType, len(result))
 
-					Logger.Error("Get failed", zap.Error(err), zap.Uint32("object_id", objectID))
+					DecodeColumns(result, &columns)
 
-					return
-				}
+					atomic.AddInt64(&reader.stats.RecordsDecoded, int64(columns.Len()))
 
-				var dp []DataPoint
+					return columns, nil
+				})
 
-				decodeData(result, dataType, &dp)
+				if hit {
 
-				cache.SetWithTTL(cacheKey, dp, 0, 1*time.Hour)
+					atomic.AddInt64(&reader.stats.CacheHits, 1)
 
-				cache.Wait()
+				} else {
 
-			}(objectID)
-		}
-	}
-}
+					atomic.AddInt64(&reader.stats.CacheMisses, 1)
+				}
 
-func (reader *Reader) waitWithContext(ctx context.Context, wg *sync.WaitGroup) error {
+				if err != nil {
 
-	done := make(chan struct{})
+					if ctx.Err() == nil {
 
-	go func() {
+						Logger.Error("Get failed", zap.Error(err), zap.Uint32("object_id", objectID))
+					}
 
-		wg.Wait()
+					return
+				}
+
+				budget.spend(series.CountRange(query.From, query.To))
 
-		close(done)
-	}()
+				reader.fetchLock.Lock()
 
-	select {
+				daySeries := reader.fetched[objectID]
 
-	case <-ctx.Done():
+				for len(daySeries) <= plan.day {
 
-		return fmt.Errorf("query timeout")
+					daySeries = append(daySeries, nil)
+				}
 
-	case <-done:
+				daySeries[plan.day] = series
 
-		return nil
+				reader.fetched[objectID] = daySeries
+
+				reader.fetchLock.Unlock()
+
+			}(objectID)
+		}
 	}
 }
 
-func (reader *Reader) mergeResults(query Query, fromTime, toTime time.Time, base string) {
+func (reader *Reader) mergeResults(query Query, dataType DataType) error {
 
 	for k := range reader.results {
 
 		delete(reader.results, k)
 	}
 
-	cache := GetCache()
-
-	for current := fromTime; !current.After(toTime); current = current.AddDate(0, 0, 1) {
+	maxPoints := getMaxPoints(query)
 
-		path := base + "/database/" + current.Format("2006/01/02") + "/counter_" + strconv.Itoa(int(query.CounterID))
+	total := 0
 
-		var objectIDs []uint32
+	for objectID, daySeries := range reader.fetched {
 
-		if len(query.ObjectIDs) == 0 {
+		points := NewColumns(dataType, 0)
 
-			objectIDs = reader.objectsMapping[path]
+		for _, series := range daySeries {
 
-			if reader.storePool.CheckEngineUsedPut(path) {
+			if series != nil {
 
-				delete(reader.objectsMapping, path)
+				series.AppendRange(&points, query.From, query.To)
 			}
-
-		} else {
-
-			objectIDs = query.ObjectIDs
 		}
 
-		for _, id := range objectIDs {
-
-			cacheKey := path + "_" + strconv.FormatUint(uint64(id), 10)
+		if total += points.Len(); maxPoints > 0 && total > maxPoints {
 
-			if cached, found := cache.Get(cacheKey); found {
-
-				reader.results[id] = append(reader.results[id], cached...)
-			}
+			return NewQueryError(ErrQueryTooLarge, "query returns more than %d points", maxPoints)
+		}
 
-			if !current.After(fromTime) || !current.Before(toTime) || reader.storePool.CheckEngineUsedPut(path) {
+		if points.Len() > 0 {
 
-				cache.Del(cacheKey)
-			}
+			reader.results[objectID] = &points
 		}
 	}
+
+	reader.stats.Points = int64(total)
+
+	return nil
 }
 
-func decodeData(data [][]byte, dataType DataType, result *[]DataPoint) {
+func DecodeData(data [][]byte, dataType DataType, result *[]DataPoint) {
 
 	for _, row := range data {
 
@@ -279,3 +514,27 @@ func decodeData(data [][]byte, dataType DataType, result *[]DataPoint) {
 		}
 	}
 }
+
+// DecodeColumns appends the records to columns, decoded as the columns' type.
+func DecodeColumns(data [][]byte, columns *Columns) {
+
+	for _, row := range data {
+
+		columns.Timestamps = append(columns.Timestamps, binary.LittleEndian.Uint32(row[:4]))
+
+		switch columns.Type {
+
+		case TypeUint64:
+
+			columns.Uint64s = append(columns.Uint64s, binary.LittleEndian.Uint64(row[4:]))
+
+		case TypeFloat64:
+
+			columns.Float64s = append(columns.Float64s, math.Float64frombits(binary.LittleEndian.Uint64(row[4:])))
+
+		case TypeString:
+
+			columns.Strings = append(columns.Strings, string(row[4:]))
+		}
+	}
+}
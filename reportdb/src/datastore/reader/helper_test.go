@@ -0,0 +1,58 @@
+package reader
+
+import (
+	"context"
+	. "reportdb/utils"
+	"testing"
+)
+
+func TestPointsBudget(t *testing.T) {
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+
+	defer cancel(nil)
+
+	budget := &pointsBudget{max: 100, cancel: cancel}
+
+	budget.spend(60)
+
+	budget.spend(40)
+
+	if ctx.Err() != nil {
+
+		t.Fatalf("budget cancelled at the limit: %v", context.Cause(ctx))
+	}
+
+	budget.spend(1)
+
+	if code := GetErrorCode(context.Cause(ctx)); code != ErrQueryTooLarge {
+
+		t.Fatalf("cause code = %s, want %s", code, ErrQueryTooLarge)
+	}
+
+	unlimited, cancelUnlimited := context.WithCancelCause(context.Background())
+
+	defer cancelUnlimited(nil)
+
+	(&pointsBudget{cancel: cancelUnlimited}).spend(1 << 30)
+
+	if unlimited.Err() != nil {
+
+		t.Fatal("budget without a limit cancelled the fetch")
+	}
+}
+
+func TestFetchDataRejectsStringAggregationLists(t *testing.T) {
+
+	if err := RegisterCounterType(803, TypeString); err != nil {
+
+		t.Fatal(err)
+	}
+
+	err := newReader(nil).FetchData(Query{CounterID: 803, From: 0, To: 100, Aggregation: "min,max"})
+
+	if GetErrorCode(err) != ErrInvalidQuery {
+
+		t.Fatalf("error = %v, want code %s", err, ErrInvalidQuery)
+	}
+}
@@ -0,0 +1,55 @@
+package reader
+
+import (
+	. "reportdb/storage"
+	. "reportdb/utils"
+)
+
+const queryTypeLatest = "latest"
+
+// LatestQuery returns the last known sample of every object of the counters,
+// map[objectID]map[counterID]sample, from the table the writers keep, so no
+// day is read. Samples carry their timestamp, so stale objects stand out.
+func (reader *Reader) LatestQuery(query Query) (interface{}, error) {
+
+	counters := query.CounterIDs
+
+	if len(counters) == 0 {
+
+		counters = []uint16{query.CounterID}
+	}
+
+	for _, counterID := range counters {
+
+		if _, err := GetCounterType(counterID); err != nil {
+
+			return nil, NewQueryError(ErrInvalidQuery, "invalid counter %d: %v", counterID, err)
+		}
+	}
+
+	latest := reader.storePool.GetLatest()
+
+	result := make(map[uint32]map[uint16]LatestSample)
+
+	for _, counterID := range counters {
+
+		for objectID, sample := range latest.Get(counterID, query.ObjectIDs) {
+
+			if result[objectID] == nil {
+
+				result[objectID] = make(map[uint16]LatestSample, len(counters))
+			}
+
+			result[objectID][counterID] = sample
+
+			reader.stats.Points++
+		}
+	}
+
+	if len(result) == 0 {
+
+		return nil, NewQueryError(ErrNoData, "no samples of counters %v", counters)
+	}
+
+	return result, nil
+}
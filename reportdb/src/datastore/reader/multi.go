@@ -0,0 +1,208 @@
+package reader
+
+import (
+	. "reportdb/utils"
+	"strings"
+)
+
+// parseAggregations splits a comma separated list of aggregations, e.g.
+// "min,avg,max". Lists may only hold numeric aggregations, which are all
+// computed from the same accumulators. A single aggregation is returned as is.
+func parseAggregations(aggregation string) ([]string, error) {
+
+	if !strings.Contains(aggregation, ",") {
+
+		return []string{aggregation}, nil
+	}
+
+	var aggregations []string
+
+	for _, name := range strings.Split(aggregation, ",") {
+
+		name = strings.ToUpper(strings.TrimSpace(name))
+
+		if !isNumericAggregation(name) {
+
+			return nil, NewQueryError(ErrInvalidQuery, "invalid aggregation %q in list, lists may only hold avg, min, max and sum", name)
+		}
+
+		duplicate := false
+
+		for _, existing := range aggregations {
+
+			duplicate = duplicate || existing == name
+		}
+
+		if !duplicate {
+
+			aggregations = append(aggregations, name)
+		}
+	}
+
+	return aggregations, nil
+}
+
+// MultiQuery runs a gauge, grid or histogram query for several aggregations in
+// one pass over the data. Wherever a single aggregation returns a value, it
+// returns an object of the values keyed by the lowercase aggregation names.
+func (reader *Reader) MultiQuery(query Query, aggregations []string) (interface{}, error) {
+
+	if !isHistogram(query) {
+
+		objects := reader.getObjectAccumulators()
+
+		if query.GroupByObjects {
+
+			grid := make(map[uint32]interface{}, len(objects)) // map[objectID]->map[aggregation]->value
+
+			for objectID, object := range objects {
+
+				values := make(map[string]interface{}, len(aggregations))
+
+				for _, aggregation := range aggregations {
+
+					values[strings.ToLower(aggregation)] = object.result(aggregation)
+				}
+
+				grid[objectID] = values
+			}
+
+			return grid, nil
+		}
+
+		values := make(map[string]interface{}, len(aggregations))
+
+		for _, aggregation := range aggregations {
+
+			var total accumulator // of the aggregates of every object
+
+			for _, object := range objects {
+
+				if value, ok := object.result(aggregation).(float64); ok {
+
+					total.add(value)
+				}
+			}
+
+			values[strings.ToLower(aggregation)] = total.result(aggregation)
+		}
+
+		return values, nil
+	}
+
+	fill, err := parseFillPolicy(query.Fill)
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	starts, err := getBucketStarts(query)
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	objectBuckets := reader.getBucketAccumulators(starts, query.From, query.To)
+
+	if query.GroupByObjects {
+
+		grouped := make(map[uint32][]DataPoint, len(objectBuckets))
+
+		for objectID := range objectBuckets {
+
+			grouped[objectID] = newMultiPoints(starts, len(aggregations))
+		}
+
+		for _, aggregation := range aggregations {
+
+			bucketed := make(map[uint32][]DataPoint, len(objectBuckets))
+
+			for objectID, accumulators := range objectBuckets {
+
+				bucketed[objectID] = getBucketPoints(starts, accumulators, aggregation)
+			}
+
+			reader.fillHistogram(query, bucketed, fill, aggregation)
+
+			for objectID, points := range bucketed {
+
+				setMultiValues(grouped[objectID], points, aggregation)
+			}
+		}
+
+		return grouped, nil
+	}
+
+	merged := newMultiPoints(starts, len(aggregations))
+
+	for _, aggregation := range aggregations {
+
+		bucketed := make(map[uint32][]DataPoint, len(objectBuckets))
+
+		for objectID, accumulators := range objectBuckets {
+
+			bucketed[objectID] = getBucketPoints(starts, accumulators, aggregation)
+		}
+
+		setMultiValues(merged, reader.fillHistogram(query, bucketed, fill, aggregation).([]DataPoint), aggregation)
+	}
+
+	return merged, nil
+}
+
+// getBucketAccumulators returns the bucket accumulators of every object,
+// folded while streaming or from the loaded columns.
+func (reader *Reader) getBucketAccumulators(starts []uint32, from uint32, to uint32) map[uint32][]accumulator {
+
+	objects := make(map[uint32][]accumulator, len(reader.results)+len(reader.aggregates))
+
+	for objectID, accumulators := range reader.aggregates {
+
+		objects[objectID] = accumulators
+	}
+
+	for objectID, points := range reader.results {
+
+		accumulators := make([]accumulator, len(starts))
+
+		newBucketFolder(starts, from, to, accumulators).addColumns(points)
+
+		objects[objectID] = accumulators
+	}
+
+	return objects
+}
+
+func newMultiPoints(starts []uint32, aggregations int) []DataPoint {
+
+	points := make([]DataPoint, len(starts))
+
+	for i, start := range starts {
+
+		points[i] = DataPoint{
+
+			Timestamp: start,
+
+			Value: make(map[string]interface{}, aggregations),
+		}
+	}
+
+	return points
+}
+
+// setMultiValues sets the values of one aggregation in the points of a list.
+// Both hold one point per bucket.
+func setMultiValues(points []DataPoint, values []DataPoint, aggregation string) {
+
+	name := strings.ToLower(aggregation)
+
+	for i := range points {
+
+		if i < len(values) {
+
+			points[i].Value.(map[string]interface{})[name] = values[i].Value
+		}
+	}
+}
@@ -1,32 +1,138 @@
 package reader
 
 import (
-	"fmt"
 	"math"
 	. "reportdb/utils"
 	"sort"
 )
 
+const (
+	queryTypeRaw = "raw"
+)
+
+func validateQueryType(query Query) error {
+
+	aggregations, err := parseAggregations(query.Aggregation)
+
+	if err != nil {
+
+		return err
+	}
+
+	if len(aggregations) > 1 && query.Type != "" {
+
+		return NewQueryError(ErrInvalidQuery, "%s queries take a single aggregation", query.Type)
+	}
+
+	if _, err := getDownsampleMethod(query); err != nil {
+
+		return err
+	}
+
+	if query.Window != nil {
+
+		if _, err := getWindowOptions(query); err != nil {
+
+			return err
+		}
+	}
+
+	switch query.Type {
+
+	case "", queryTypeRaw, queryTypeLatest:
+
+		return nil
+
+	case queryTypeBaseline:
+
+		_, err := getBaselineOptions(query)
+
+		return err
+
+	case queryTypeForecast:
+
+		_, err := getForecastOptions(query)
+
+		return err
+
+	case queryTypeHeatmap:
+
+		_, err := getHeatmapOptions(query)
+
+		return err
+	}
+
+	return NewQueryError(ErrInvalidQuery, "unknown query type %q", query.Type)
+}
+
+// getFetchFrom returns the first timestamp FetchData reads, earlier than
+// query.From for query types that compare the range with its history.
+func getFetchFrom(query Query) (uint32, error) {
+
+	switch query.Type {
+
+	case queryTypeBaseline:
+
+		return getBaselineFrom(query)
+
+	case queryTypeForecast:
+
+		return getForecastFrom(query)
+	}
+
+	return query.From, nil
+}
+
 func (reader *Reader) ParseResult(query Query) (interface{}, error) {
 
-	if len(reader.results) == 0 {
+	if len(reader.results) == 0 && len(reader.aggregates) == 0 {
 
-		return nil, fmt.Errorf("no data available for processing")
+		return nil, NewQueryError(ErrNoData, "no data available for processing")
 	}
 
 	dataType, err := GetCounterType(query.CounterID)
 
 	if err != nil {
 
-		return nil, fmt.Errorf("reader.fetchData error : %v", err)
+		return nil, NewQueryError(ErrInvalidQuery, "reader.fetchData error : %v", err)
+	}
+
+	if query.Type == queryTypeRaw {
+
+		return reader.RawQuery(query)
+	}
+
+	if query.Type == queryTypeBaseline {
+
+		return reader.BaselineQuery(query, dataType)
+	}
+
+	if query.Type == queryTypeForecast {
+
+		return reader.ForecastQuery(query, dataType)
+	}
+
+	if query.Type == queryTypeHeatmap {
+
+		return reader.HeatmapQuery(query, dataType)
+	}
+
+	if isStringAggregation(query.Aggregation) {
+
+		return reader.StringQuery(query)
 	}
 
 	if dataType == TypeString {
 
-		return reader.results, nil
+		return reader.getPoints(), nil // numeric aggregations don't apply to strings
+	}
+
+	if aggregations, _ := parseAggregations(query.Aggregation); len(aggregations) > 1 {
+
+		return reader.MultiQuery(query, aggregations)
 	}
 
-	if query.Interval == 0 {
+	if !isHistogram(query) {
 
 		if query.GroupByObjects {
 
@@ -41,6 +147,21 @@ func (reader *Reader) ParseResult(query Query) (interface{}, error) {
 
 func (reader *Reader) GaugeQuery(query Query) (interface{}, error) {
 
+	if isNumericAggregation(query.Aggregation) {
+
+		var total accumulator // of the aggregates of every object
+
+		for _, object := range reader.getObjectAccumulators() {
+
+			if value, ok := object.result(query.Aggregation).(float64); ok {
+
+				total.add(value)
+			}
+		}
+
+		return total.result(query.Aggregation), nil
+	}
+
 	reader.dataValues = reader.dataValues[:0]
 
 	for _, points := range reader.results {
@@ -54,92 +175,152 @@ func (reader *Reader) GaugeQuery(query Query) (interface{}, error) {
 
 func (reader *Reader) HistogramQuery(query Query) (interface{}, error) {
 
-	bucketed := reader.bucketData(uint32(query.Interval), query.From, query.To, query.Aggregation)
+	fill, err := parseFillPolicy(query.Fill)
+
+	if err != nil {
 
-	if query.GroupByObjects {
+		return nil, err
+	}
+
+	starts, err := getBucketStarts(query)
+
+	if err != nil {
 
-		return bucketed, nil
+		return nil, err
 	}
 
-	return reader.mergeAllObjects(query.Aggregation), nil
+	bucketed := reader.bucketData(starts, query.From, query.To, query.Aggregation)
+
+	histogram := reader.fillHistogram(query, bucketed, fill, query.Aggregation)
+
+	if query.MaxPoints > 0 {
+
+		method, _ := getDownsampleMethod(query) // validated before fetching
+
+		return downsampleHistogram(histogram, query.MaxPoints, method), nil
+	}
+
+	return histogram, nil
+}
+
+// fillHistogram applies the window function to the buckets of every object,
+// then fills them, or merges the objects and fills the merged buckets.
+func (reader *Reader) fillHistogram(query Query, bucketed map[uint32][]DataPoint, fill fillPolicy, aggregation string) interface{} {
+
+	if query.Window != nil {
+
+		window, _ := getWindowOptions(query) // validated before fetching
+
+		for _, points := range bucketed {
+
+			applyWindow(points, window)
+		}
+	}
+
+	if query.GroupByObjects || query.MergeEmpty {
+
+		for _, points := range bucketed {
+
+			fillGaps(points, fill)
+		}
+
+		if query.GroupByObjects {
+
+			return bucketed
+		}
+	}
+
+	merged := reader.mergeAllObjects(bucketed, aggregation)
+
+	fillGaps(merged, fill)
+
+	return merged
 }
 
 func (reader *Reader) GridQuery(query Query) (interface{}, error) {
 
-	for k := range reader.grid {
+	grid := make(map[uint32]interface{}, len(reader.results)) // map[objectID]->value
+
+	if isNumericAggregation(query.Aggregation) {
 
-		delete(reader.grid, k)
+		for objID, object := range reader.getObjectAccumulators() {
+
+			grid[objID] = object.result(query.Aggregation)
+		}
+
+		return grid, nil
 	}
 
 	for objID, points := range reader.results {
 
-		reader.grid[objID] = aggregateValues(reader.getValues(points), query.Aggregation)
+		grid[objID] = aggregateValues(reader.getValues(points), query.Aggregation)
 	}
 
-	return reader.grid, nil
+	return grid, nil
 }
 
-func (reader *Reader) bucketData(interval uint32, from uint32, to uint32, aggregation string) map[uint32][]DataPoint {
+func (reader *Reader) bucketData(starts []uint32, from uint32, to uint32, aggregation string) map[uint32][]DataPoint {
+
+	bucketed := make(map[uint32][]DataPoint, len(reader.results)) // map[objectID]->[]DataPoint
 
-	for k := range reader.bucketed {
+	for objID, accumulators := range reader.aggregates {
 
-		delete(reader.bucketed, k)
+		bucketed[objID] = getBucketPoints(starts, accumulators, aggregation)
 	}
 
 	for objID, points := range reader.results {
 
-		reader.bucketed[objID] = reader.createBuckets(points, interval, from, to, aggregation)
+		bucketed[objID] = reader.createBuckets(points, starts, from, to, aggregation)
 	}
 
-	return reader.bucketed
+	return bucketed
 }
 
-func (reader *Reader) createBuckets(points []DataPoint, interval uint32, from uint32, to uint32, aggregation string) []DataPoint {
+func (reader *Reader) createBuckets(points *Columns, starts []uint32, from uint32, to uint32, aggregation string) []DataPoint {
 
-	sort.Slice(points, func(i, j int) bool {
+	points.Sort()
 
-		return points[i].Timestamp < points[j].Timestamp
-	})
+	if isNumericAggregation(aggregation) {
+
+		return reader.createNumericBuckets(points, starts, from, to, aggregation)
+	}
 
 	for k := range reader.bucketMap { // map[timestamp]->[points]
 
 		delete(reader.bucketMap, k)
 	}
 
-	for _, point := range points {
+	for i, timestamp := range points.Timestamps {
 
-		if point.Timestamp < from || point.Timestamp > to {
+		if timestamp < from || timestamp > to {
 
 			continue
 		}
 
-		bucket := point.Timestamp - (point.Timestamp % interval)
-
-		reader.bucketMap[bucket] = append(reader.bucketMap[bucket], point.Value)
-	}
+		index := sort.Search(len(starts), func(i int) bool {
 
-	var bucketed = make([]DataPoint, 0, (to-from)/interval)
+			return starts[i] > timestamp
+		}) - 1
 
-	for time := from - (from % interval); time <= to; time += interval {
+		if index < 0 {
 
-		values := reader.bucketMap[time]
-
-		var aggregated interface{}
+			continue
+		}
 
-		if len(values) > 0 {
+		reader.bucketMap[starts[index]] = append(reader.bucketMap[starts[index]], points.Value(i))
+	}
 
-			aggregated = aggregateValues(values, aggregation)
+	var bucketed = make([]DataPoint, 0, len(starts))
 
-		} else {
+	for _, time := range starts {
 
-			aggregated = 0
-		}
+		values := reader.bucketMap[time]
 
 		bucketed = append(bucketed, DataPoint{
 
 			Timestamp: time,
 
-			Value: aggregated,
+			Value: aggregateValues(values, aggregation), // nil for empty buckets, filled later
 		})
 
 	}
@@ -147,11 +328,29 @@ func (reader *Reader) createBuckets(points []DataPoint, interval uint32, from ui
 	return bucketed
 }
 
-func (reader *Reader) mergeAllObjects(aggregation string) []DataPoint {
+// createNumericBuckets aggregates sorted numeric columns into the buckets
+// without boxing a value, only the aggregate of each bucket is boxed.
+func (reader *Reader) createNumericBuckets(points *Columns, starts []uint32, from uint32, to uint32, aggregation string) []DataPoint {
+
+	accumulators := reader.accumulators[:0]
+
+	for range starts {
+
+		accumulators = append(accumulators, accumulator{})
+	}
+
+	reader.accumulators = accumulators
+
+	newBucketFolder(starts, from, to, accumulators).addColumns(points)
+
+	return getBucketPoints(starts, accumulators, aggregation)
+}
+
+func (reader *Reader) mergeAllObjects(bucketed map[uint32][]DataPoint, aggregation string) []DataPoint {
 
 	reader.allDataPoints = reader.allDataPoints[:0]
 
-	for _, points := range reader.bucketed {
+	for _, points := range bucketed {
 
 		reader.allDataPoints = append(reader.allDataPoints, points...)
 	}
@@ -163,15 +362,15 @@ func (reader *Reader) mergeAllObjects(aggregation string) []DataPoint {
 
 	var currentTime uint32
 
-	reader.dataPoints = reader.dataPoints[:0]
+	var merged []DataPoint
 
 	reader.dataValues = reader.dataValues[:0]
 
-	for _, point := range reader.allDataPoints {
+	for i, point := range reader.allDataPoints {
 
-		if point.Timestamp != currentTime && len(reader.dataValues) > 0 {
+		if point.Timestamp != currentTime && i > 0 {
 
-			reader.dataPoints = append(reader.dataPoints, DataPoint{
+			merged = append(merged, DataPoint{
 
 				Timestamp: currentTime,
 
@@ -183,13 +382,16 @@ func (reader *Reader) mergeAllObjects(aggregation string) []DataPoint {
 
 		currentTime = point.Timestamp
 
-		reader.dataValues = append(reader.dataValues, point.Value)
+		if point.Value != nil { // empty buckets don't take part in the merge
+
+			reader.dataValues = append(reader.dataValues, point.Value)
+		}
 
 	}
 
-	if len(reader.dataValues) > 0 {
+	if len(reader.allDataPoints) > 0 {
 
-		reader.dataPoints = append(reader.dataPoints, DataPoint{
+		merged = append(merged, DataPoint{
 
 			Timestamp: currentTime,
 
@@ -198,22 +400,58 @@ func (reader *Reader) mergeAllObjects(aggregation string) []DataPoint {
 
 	}
 
-	return reader.dataPoints
+	return merged
 }
 
-func (reader *Reader) getValues(points []DataPoint) []interface{} {
+func (reader *Reader) getValues(points *Columns) []interface{} {
 
 	reader.getDataValues = reader.getDataValues[:0]
 
-	for _, point := range points {
+	for i := range points.Timestamps {
 
-		reader.getDataValues = append(reader.getDataValues, point.Value)
+		reader.getDataValues = append(reader.getDataValues, points.Value(i))
 
 	}
 
 	return reader.getDataValues
 }
 
+// getObjectAccumulators returns the accumulator of every object over the whole
+// range, folded while streaming or from the loaded columns.
+func (reader *Reader) getObjectAccumulators() map[uint32]accumulator {
+
+	objects := make(map[uint32]accumulator, len(reader.results)+len(reader.aggregates))
+
+	for objID, accumulators := range reader.aggregates {
+
+		objects[objID] = accumulators[0]
+	}
+
+	for objID, points := range reader.results {
+
+		var object accumulator
+
+		object.addColumns(points)
+
+		objects[objID] = object
+	}
+
+	return objects
+}
+
+// getPoints boxes the results for the paths that work on values of any type.
+func (reader *Reader) getPoints() map[uint32][]DataPoint {
+
+	points := make(map[uint32][]DataPoint, len(reader.results))
+
+	for objectID, columns := range reader.results {
+
+		points[objectID] = columns.Points()
+	}
+
+	return points
+}
+
 func aggregateValues(values []interface{}, aggType string) interface{} {
 
 	if len(values) == 0 {
@@ -245,7 +483,7 @@ func aggregateValues(values []interface{}, aggType string) interface{} {
 		return values[0]
 	}
 
-	return values
+	return append([]interface{}(nil), values...) // values is a reused buffer
 }
 
 func getAverage(values []interface{}) float64 {
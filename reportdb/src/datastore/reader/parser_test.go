@@ -0,0 +1,103 @@
+package reader
+
+import (
+	"fmt"
+	. "reportdb/utils"
+	"testing"
+)
+
+// TestParseResultOwnsItsData parses a result, reuses the reader for another
+// query and checks the first result is left as it was, since responses are
+// encoded after their reader went back to the pool.
+func TestParseResultOwnsItsData(t *testing.T) {
+
+	for counterID, dataType := range map[uint16]DataType{801: TypeFloat64, 802: TypeString} {
+
+		if err := RegisterCounterType(counterID, dataType); err != nil {
+
+			t.Fatal(err)
+		}
+	}
+
+	load := func(reader *Reader, dataType DataType, value func(i int) interface{}) {
+
+		for k := range reader.results {
+
+			delete(reader.results, k)
+		}
+
+		for objectID := uint32(1); objectID <= 2; objectID++ {
+
+			columns := NewColumns(dataType, 0)
+
+			for i := 0; i < 6; i++ {
+
+				columns.Append(uint32(i*10), value(i+int(objectID)))
+			}
+
+			reader.results[objectID] = &columns
+		}
+	}
+
+	tests := []struct {
+		name string
+
+		query Query
+	}{
+		{"string points", Query{CounterID: 802, Aggregation: "AVG"}},
+
+		{"string histogram", Query{CounterID: 802, Aggregation: "LAST", Interval: 20}},
+
+		{"string grid", Query{CounterID: 802, Aggregation: "MODE", GroupByObjects: true}},
+
+		{"numeric histogram", Query{CounterID: 801, Aggregation: "AVG", Interval: 20}},
+
+		{"numeric grouped histogram", Query{CounterID: 801, Aggregation: "MAX", Interval: 20, GroupByObjects: true}},
+
+		{"numeric multi", Query{CounterID: 801, Aggregation: "MIN,MAX", Interval: 20}},
+
+		{"raw", Query{CounterID: 801, Type: queryTypeRaw}},
+	}
+
+	for _, test := range tests {
+
+		reader := newReader(nil)
+
+		dataType, _ := GetCounterType(test.query.CounterID)
+
+		value := func(i int) interface{} {
+
+			if dataType == TypeString {
+
+				return fmt.Sprintf("v%d", i)
+			}
+
+			return float64(i)
+		}
+
+		load(reader, dataType, value)
+
+		test.query.To = 59
+
+		data, err := reader.ParseResult(test.query)
+
+		if err != nil {
+
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		want := fmt.Sprintf("%v", data)
+
+		load(reader, dataType, func(i int) interface{} { return value(i + 100) })
+
+		if _, err := reader.ParseResult(test.query); err != nil {
+
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		if got := fmt.Sprintf("%v", data); got != want {
+
+			t.Errorf("%s: result changed by the next query on the reader:\n%s\nwant\n%s", test.name, got, want)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package reader
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	. "reportdb/utils"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	formatJSON = "json"
+
+	formatCSV = "csv"
+
+	formatNDJSON = "ndjson"
+
+	defaultRawLimit = 10000
+)
+
+type rawRow struct {
+	ObjectID uint32 `json:"object_id"`
+
+	Timestamp uint32 `json:"timestamp"`
+
+	Value interface{} `json:"value"`
+}
+
+type rawPage struct {
+	Total int `json:"total"` // rows in the whole range
+
+	Offset int `json:"offset"`
+
+	NextOffset int `json:"next_offset,omitempty"` // offset of the next page, omitted on the last page
+
+	Format string `json:"format"`
+
+	Rows interface{} `json:"rows"` // []rawRow for json, a string for csv and ndjson
+}
+
+// RawQuery returns every point in the range unaggregated, ordered by object
+// and timestamp, one page of query.Limit rows at a time.
+func (reader *Reader) RawQuery(query Query) (interface{}, error) {
+
+	format := strings.ToLower(query.Format)
+
+	if format == "" {
+
+		format = formatJSON
+	}
+
+	if format != formatJSON && format != formatCSV && format != formatNDJSON {
+
+		return nil, NewQueryError(ErrInvalidQuery, "invalid format %q, expected json, csv or ndjson", query.Format)
+	}
+
+	limit := query.Limit
+
+	if limit <= 0 {
+
+		limit = defaultRawLimit
+	}
+
+	if query.Offset < 0 {
+
+		return nil, NewQueryError(ErrInvalidQuery, "invalid offset %d", query.Offset)
+	}
+
+	if query.MaxPoints > 0 {
+
+		method, _ := getDownsampleMethod(query) // validated before fetching
+
+		for objectID, points := range reader.results {
+
+			points.Sort()
+
+			reader.results[objectID] = downsampleColumns(points, query.MaxPoints, method)
+		}
+	}
+
+	objectIDs := make([]uint32, 0, len(reader.results))
+
+	total := 0
+
+	for objectID, points := range reader.results {
+
+		objectIDs = append(objectIDs, objectID)
+
+		total += points.Len()
+	}
+
+	sort.Slice(objectIDs, func(i, j int) bool {
+
+		return objectIDs[i] < objectIDs[j]
+	})
+
+	rows := make([]rawRow, 0, min(limit, max(total-query.Offset, 0)))
+
+	skip := query.Offset
+
+	for _, objectID := range objectIDs {
+
+		points := reader.results[objectID]
+
+		if skip >= points.Len() {
+
+			skip -= points.Len()
+
+			continue
+		}
+
+		points.Sort()
+
+		for i := skip; i < points.Len(); i++ {
+
+			if len(rows) == limit {
+
+				break
+			}
+
+			rows = append(rows, rawRow{
+
+				ObjectID: objectID,
+
+				Timestamp: points.Timestamps[i],
+
+				Value: points.Value(i),
+			})
+		}
+
+		skip = 0
+
+		if len(rows) == limit {
+
+			break
+		}
+	}
+
+	page := rawPage{
+
+		Total: total,
+
+		Offset: query.Offset,
+
+		Format: format,
+
+		Rows: rows,
+	}
+
+	if query.Offset+len(rows) < total {
+
+		page.NextOffset = query.Offset + len(rows)
+	}
+
+	var err error
+
+	switch format {
+
+	case formatCSV:
+
+		page.Rows, err = encodeCSV(rows)
+
+	case formatNDJSON:
+
+		page.Rows, err = encodeNDJSON(rows)
+	}
+
+	if err != nil {
+
+		return nil, fmt.Errorf("encoding %s rows: %v", format, err)
+	}
+
+	return page, nil
+}
+
+func encodeCSV(rows []rawRow) (string, error) {
+
+	var builder strings.Builder
+
+	writer := csv.NewWriter(&builder)
+
+	if err := writer.Write([]string{"object_id", "timestamp", "value"}); err != nil {
+
+		return "", err
+	}
+
+	for _, row := range rows {
+
+		record := []string{
+
+			strconv.FormatUint(uint64(row.ObjectID), 10),
+
+			strconv.FormatUint(uint64(row.Timestamp), 10),
+
+			fmt.Sprint(row.Value),
+		}
+
+		if err := writer.Write(record); err != nil {
+
+			return "", err
+		}
+	}
+
+	writer.Flush()
+
+	return builder.String(), writer.Error()
+}
+
+func encodeNDJSON(rows []rawRow) (string, error) {
+
+	var builder strings.Builder
+
+	encoder := json.NewEncoder(&builder) // writes one JSON document per line
+
+	for _, row := range rows {
+
+		if err := encoder.Encode(row); err != nil {
+
+			return "", err
+		}
+	}
+
+	return builder.String(), nil
+}
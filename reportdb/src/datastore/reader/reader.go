@@ -1,185 +1,332 @@
 package reader
 
 import (
-	"fmt"
 	"go.uber.org/zap"
+	. "reportdb/cache"
 	. "reportdb/logger"
 	. "reportdb/storage"
 	. "reportdb/utils"
+	"strings"
 	"sync"
+	"time"
 )
 
-type Reader struct {
-	id uint8
+const (
+	PriorityInteractive = "interactive"
 
-	objectPool chan struct{} // to read multiple key data in parallel for a query
+	PriorityBulk = "bulk"
+)
 
-	queryEvents chan QueryReceive // channel to take query from query distributor
+// Executor runs queries on a fixed number of workers, the global limit of
+// queries executing at once. Workers take queries from shared lanes, so an
+// idle worker picks up whatever is waiting, and they always take interactive
+// queries first. Bulk queries may occupy at most half of the workers, so
+// dashboards keep running while reports are.
+type Executor struct {
+	interactive chan QueryReceive
+
+	bulk chan QueryReceive
+
+	bulkSlots chan struct{} // held by every worker running a bulk query
 
 	resultChannel chan Response // channel to send query result
 
+	readers sync.Pool // per-query scratch state
+
+	waitGroup *sync.WaitGroup // to wait completion of all workers
+}
+
+// Reader holds the state of one query while it executes. Readers come from
+// the executor's pool and are never shared by two running queries.
+type Reader struct {
+	objectPool chan struct{} // to read multiple key data in parallel for a query
+
 	storePool *StorePool
 
-	waitGroup *sync.WaitGroup // to wait completion of all readers
+	fetched map[uint32][]*Series // map[objectID]->[day]series, filled concurrently by object workers
+
+	fetchLock sync.Mutex
 
-	objectsMapping map[string][]uint32 // useful when no objectId given in a query
+	results map[uint32]*Columns // result of query
 
-	results map[uint32][]DataPoint // result of query
+	aggregates map[uint32][]accumulator // map[objectID]->[bucket], result of streamed queries
+
+	stats *QueryStats // execution statistics of the running query
 
 	ParserBuffer
 }
 
+// ParserBuffer holds scratch space reused across queries. Nothing in it may
+// end up in a Response, responses are encoded after the reader is reused.
 type ParserBuffer struct {
 	dataValues []interface{}
 
 	getDataValues []interface{}
 
-	dataPoints []DataPoint
-
 	allDataPoints []DataPoint
 
-	grid map[uint32]interface{} // map[objectID]->value
-
-	bucketed map[uint32][]DataPoint // map[objectID]->[]DataPoint
-
 	bucketMap map[uint32][]interface{} // map[timestamp]->[values]
+
+	accumulators []accumulator // buckets of numeric histograms
 }
 
-func StartReaders(storePool *StorePool, resultChannel chan Response) ([]*Reader, error) {
+func StartExecutor(storePool *StorePool, resultChannel chan Response) *Executor {
 
-	readers, err := initializeReaders(storePool, resultChannel)
+	workers := GetReaders()
 
-	if err != nil {
+	executor := &Executor{
 
-		return readers, fmt.Errorf("startReaders : Error initializing readers: %v", err)
-	}
+		interactive: make(chan QueryReceive, GetQueryBuffer()),
+
+		bulk: make(chan QueryReceive, GetQueryBuffer()),
+
+		bulkSlots: make(chan struct{}, max(workers/2, 1)),
 
-	for _, reader := range readers {
+		resultChannel: resultChannel,
 
-		reader.runReader()
+		waitGroup: &sync.WaitGroup{},
 	}
 
-	return readers, nil
-}
+	executor.readers.New = func() interface{} {
 
-func initializeReaders(storePool *StorePool, resultChannel chan Response) ([]*Reader, error) {
+		return newReader(storePool)
+	}
 
-	readers := make([]*Reader, GetReaders())
+	for i := 0; i < workers; i++ {
 
-	for i := range readers {
+		executor.runWorker()
+	}
 
-		readers[i] = &Reader{
+	return executor
+}
 
-			id: uint8(i),
+func newReader(storePool *StorePool) *Reader {
 
-			objectPool: make(chan struct{}, GetObjectWorkers()),
+	reader := &Reader{
 
-			queryEvents: make(chan QueryReceive, GetQueryBuffer()),
+		objectPool: make(chan struct{}, GetObjectWorkers()),
 
-			resultChannel: resultChannel,
+		storePool: storePool,
 
-			storePool: storePool,
+		fetched: make(map[uint32][]*Series),
 
-			waitGroup: &sync.WaitGroup{},
+		results: make(map[uint32]*Columns),
 
-			objectsMapping: make(map[string][]uint32),
+		aggregates: make(map[uint32][]accumulator),
 
-			results: make(map[uint32][]DataPoint),
+		ParserBuffer: ParserBuffer{
 
-			ParserBuffer: ParserBuffer{
+			dataValues: make([]interface{}, 0, 100),
 
-				dataValues: make([]interface{}, 0, 100),
+			getDataValues: make([]interface{}, 0, 100),
 
-				getDataValues: make([]interface{}, 0, 100),
+			allDataPoints: make([]DataPoint, 0, 100),
 
-				dataPoints: make([]DataPoint, 0, 100),
+			bucketMap: make(map[uint32][]interface{}),
+		},
+	}
 
-				allDataPoints: make([]DataPoint, 0, 100),
+	for j := 0; j < GetObjectWorkers(); j++ {
 
-				grid: make(map[uint32]interface{}),
+		reader.objectPool <- struct{}{}
+	}
 
-				bucketed: make(map[uint32][]DataPoint),
+	return reader
+}
 
-				bucketMap: make(map[uint32][]interface{}),
-			},
-		}
+// Submit queues a query in the lane of its priority.
+func (executor *Executor) Submit(query QueryReceive) {
 
-		for j := 0; j < GetObjectWorkers(); j++ {
+	if strings.ToLower(query.Query.Priority) == PriorityBulk {
 
-			readers[i].objectPool <- struct{}{}
-		}
+		executor.bulk <- query
 
+		return
 	}
 
-	return readers, nil
+	executor.interactive <- query
 }
 
-func (reader *Reader) runReader() {
+func (executor *Executor) runWorker() {
 
-	reader.waitGroup.Add(1)
+	executor.waitGroup.Add(1)
 
 	go func() {
 
-		defer reader.waitGroup.Done()
+		defer executor.waitGroup.Done()
 
-		for query := range reader.queryEvents {
+		interactive, bulk := executor.interactive, executor.bulk
 
-			err := reader.FetchData(query.Query)
+		for interactive != nil || bulk != nil {
 
-			if err != nil {
+			select { // interactive queries first, whatever is waiting in bulk
 
-				Logger.Error("Error fetching data from reader", zap.Error(err))
+			case query, ok := <-interactive:
 
-				response := Response{
+				if !ok {
 
-					RequestID: query.RequestID,
+					interactive = nil
 
-					Error: err.Error(),
+					continue
 				}
 
-				reader.resultChannel <- response
+				executor.execute(query)
 
 				continue
+
+			default:
 			}
 
-			parseResult, err := reader.ParseResult(query.Query)
+			// only offer to take a bulk query while a bulk slot is free
+			var bulkLane chan QueryReceive
+
+			if bulk != nil {
+
+				if interactive == nil {
+
+					executor.bulkSlots <- struct{}{} // nothing else to wait for
 
-			var response Response
+					bulkLane = bulk
 
-			if err != nil {
+				} else {
 
-				Logger.Error("Error fetching data from reader", zap.Error(err))
+					select {
 
-				response = Response{
+					case executor.bulkSlots <- struct{}{}:
 
-					RequestID: query.RequestID,
+						bulkLane = bulk
 
-					Error: err.Error(),
+					default:
+					}
 				}
+			}
 
-			} else {
+			select {
 
-				response = Response{
+			case query, ok := <-interactive:
 
-					RequestID: query.RequestID,
+				if bulkLane != nil {
 
-					Data: parseResult,
+					<-executor.bulkSlots
 				}
-			}
 
-			reader.resultChannel <- response
-		}
+				if !ok {
+
+					interactive = nil
+
+					continue
+				}
+
+				executor.execute(query)
+
+			case query, ok := <-bulkLane:
+
+				if ok {
+
+					executor.execute(query)
+
+				} else {
 
+					bulk = nil
+				}
+
+				<-executor.bulkSlots
+			}
+		}
 	}()
 }
 
-func ShutdownReaders(readers []*Reader) {
+func (executor *Executor) execute(query QueryReceive) {
+
+	reader := executor.readers.Get().(*Reader)
+
+	response := reader.runQuery(query)
 
-	for _, reader := range readers {
+	if query.Reply != nil {
 
-		close(reader.queryEvents)
+		query.Reply(response)
 
-		reader.waitGroup.Wait()
+	} else {
+
+		executor.resultChannel <- response
 	}
 
+	reader.stats = nil
+
+	executor.readers.Put(reader)
+}
+
+// runQuery answers one query. Nothing in the response may belong to the
+// reader, responses are encoded after execute put it back in the pool.
+func (reader *Reader) runQuery(query QueryReceive) Response {
+
+	started := time.Now()
+
+	reader.stats = &QueryStats{}
+
+	response := Response{
+
+		RequestID: query.RequestID,
+	}
+
+	var err error
+
+	if query.Query.Type == queryTypeLatest {
+
+		response.Data, err = reader.LatestQuery(query.Query) // answered from memory, nothing is fetched
+
+	} else if len(query.Query.Offsets) > 0 {
+
+		response.Data, err = reader.ShiftQuery(query.Query) // fetches and parses every shifted range
+
+	} else if err = reader.FetchData(query.Query); err == nil {
+
+		parseStarted := time.Now()
+
+		response.Data, err = reader.ParseResult(query.Query)
+
+		reader.stats.ParseTime = time.Since(parseStarted).Nanoseconds()
+	}
+
+	if err != nil {
+
+		Logger.Error("Error fetching data from reader", zap.Error(err))
+
+		response.Data = nil
+
+		response.Error = err.Error()
+
+		response.Code = GetErrorCode(err)
+	}
+
+	reader.stats.TotalTime = time.Since(started).Nanoseconds()
+
+	if threshold := GetSlowQueryThreshold(); threshold > 0 && time.Duration(reader.stats.TotalTime) >= time.Duration(threshold)*time.Millisecond {
+
+		Logger.Warn("Slow query",
+			zap.Uint64("request_id", query.RequestID),
+			zap.Uint16("counter_id", query.Query.CounterID),
+			zap.Uint32("from", query.Query.From),
+			zap.Uint32("to", query.Query.To),
+			zap.String("code", response.Code),
+			zap.Any("stats", reader.stats),
+		)
+	}
+
+	if query.Query.Explain {
+
+		response.Stats = reader.stats
+	}
+
+	return response
+}
+
+// Shutdown lets the workers finish the queued queries and waits for them.
+func (executor *Executor) Shutdown() {
+
+	close(executor.interactive)
+
+	close(executor.bulk)
+
+	executor.waitGroup.Wait()
 }
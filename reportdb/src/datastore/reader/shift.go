@@ -0,0 +1,185 @@
+package reader
+
+import (
+	"context"
+	. "reportdb/utils"
+	"strings"
+	"time"
+)
+
+const maxShiftOffsets = 8
+
+// shiftedSeries is the result of a query over its range shifted back by
+// Offset seconds, with timestamps realigned onto the range. Data is nil when
+// the shifted range holds no data.
+type shiftedSeries struct {
+	Offset int `json:"offset"`
+
+	Data interface{} `json:"data"`
+}
+
+func validateOffsets(query Query) error {
+
+	if query.Type != "" {
+
+		return NewQueryError(ErrInvalidQuery, "%s queries can't take offsets", query.Type)
+	}
+
+	if strings.ToUpper(query.Aggregation) == aggChanges {
+
+		return NewQueryError(ErrInvalidQuery, "offsets can't be used with changes")
+	}
+
+	if len(query.Offsets) > maxShiftOffsets {
+
+		return NewQueryError(ErrInvalidQuery, "at most %d offsets can be compared, got %d", maxShiftOffsets, len(query.Offsets))
+	}
+
+	for _, offset := range query.Offsets {
+
+		if offset <= 0 || int64(offset) > int64(query.From) {
+
+			return NewQueryError(ErrInvalidQuery, "invalid offset %d, offsets must be positive and not reach before the epoch", offset)
+		}
+	}
+
+	return nil
+}
+
+// ShiftQuery runs a query over its range and over the range shifted back by
+// every offset, and returns the results side by side, the unshifted one first,
+// so "today" and "same time last week" can be overlaid.
+func (reader *Reader) ShiftQuery(query Query) (interface{}, error) {
+
+	if err := validateOffsets(query); err != nil {
+
+		return nil, err
+	}
+
+	offsets := append([]int{0}, query.Offsets...)
+
+	if err := reader.checkShiftCost(query, offsets); err != nil {
+
+		return nil, err
+	}
+
+	series := make([]shiftedSeries, 0, len(offsets))
+
+	found := false
+
+	var planTime, fetchTime, mergeTime, parseTime int64 // FetchData times each run only
+
+	defer func() {
+
+		reader.stats.PlanTime, reader.stats.FetchTime, reader.stats.MergeTime, reader.stats.ParseTime = planTime, fetchTime, mergeTime, parseTime
+	}()
+
+	for _, offset := range offsets {
+
+		shifted := query
+
+		shifted.Offsets = nil
+
+		shifted.From -= uint32(offset)
+
+		shifted.To -= uint32(offset)
+
+		reader.stats.PlanTime, reader.stats.FetchTime, reader.stats.MergeTime = 0, 0, 0
+
+		err := reader.FetchData(shifted)
+
+		planTime, fetchTime, mergeTime = planTime+reader.stats.PlanTime, fetchTime+reader.stats.FetchTime, mergeTime+reader.stats.MergeTime
+
+		var data interface{}
+
+		if err == nil {
+
+			parseStarted := time.Now()
+
+			data, err = reader.ParseResult(shifted)
+
+			parseTime += time.Since(parseStarted).Nanoseconds()
+		}
+
+		if err != nil && GetErrorCode(err) != ErrNoData {
+
+			return nil, err
+		}
+
+		if err == nil {
+
+			found = true
+
+			shiftTimestamps(data, uint32(offset))
+		}
+
+		series = append(series, shiftedSeries{Offset: offset, Data: data})
+	}
+
+	if !found {
+
+		return nil, NewQueryError(ErrNoData, "no data found in time range %d-%d or its offsets", query.From, query.To)
+	}
+
+	return series, nil
+}
+
+// checkShiftCost checks the limits against every shifted range together
+// before any of them is fetched, a query reads its range once per offset.
+func (reader *Reader) checkShiftCost(query Query, offsets []int) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*time.Duration(GetQueryTimeout()))
+
+	defer cancel()
+
+	days, engines := reader.stats.Days, reader.stats.EnginesOpened
+
+	defer func() {
+
+		reader.stats.Days, reader.stats.EnginesOpened = days, engines // counted again by every run
+	}()
+
+	var plans []dayPlan
+
+	for _, offset := range offsets {
+
+		shifted := query
+
+		shifted.From -= uint32(offset)
+
+		shifted.To -= uint32(offset)
+
+		shiftedPlans, err := reader.planQuery(ctx, shifted)
+
+		if err != nil {
+
+			return err
+		}
+
+		plans = append(plans, shiftedPlans...)
+	}
+
+	return reader.checkQueryCost(query, plans)
+}
+
+// shiftTimestamps moves the points of a histogram forward by offset seconds.
+// Gauge and grid results hold no timestamps.
+func shiftTimestamps(data interface{}, offset uint32) {
+
+	switch result := data.(type) {
+
+	case []DataPoint:
+
+		for i := range result {
+
+			result[i].Timestamp += offset
+		}
+
+	case map[uint32][]DataPoint:
+
+		for _, points := range result {
+
+			shiftTimestamps(points, offset)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package reader
+
+import (
+	"encoding/json"
+	"reflect"
+	. "reportdb/utils"
+	"strings"
+	"testing"
+)
+
+func TestValidateOffsets(t *testing.T) {
+
+	tests := []struct {
+		name string
+
+		query Query
+
+		code string
+	}{
+		{"day and week", Query{From: 1000000, Aggregation: "AVG", Offsets: []int{86400, 604800}}, ""},
+
+		{"negative", Query{From: 1000000, Offsets: []int{-1}}, ErrInvalidQuery},
+
+		{"zero", Query{From: 1000000, Offsets: []int{0}}, ErrInvalidQuery},
+
+		{"before the epoch", Query{From: 1000, Offsets: []int{1001}}, ErrInvalidQuery},
+
+		{"too many", Query{From: 1000000, Offsets: make([]int, maxShiftOffsets+1)}, ErrInvalidQuery},
+
+		{"raw query", Query{From: 1000000, Type: queryTypeRaw, Offsets: []int{60}}, ErrInvalidQuery},
+
+		{"changes", Query{From: 1000000, Aggregation: "changes", Offsets: []int{60}}, ErrInvalidQuery},
+	}
+
+	for _, test := range tests {
+
+		err := validateOffsets(test.query)
+
+		if test.code == "" && err != nil || test.code != "" && GetErrorCode(err) != test.code {
+
+			t.Errorf("%s: error = %v, want code %q", test.name, err, test.code)
+		}
+	}
+}
+
+func TestShiftTimestamps(t *testing.T) {
+
+	merged := []DataPoint{{Timestamp: 100, Value: 1.0}, {Timestamp: 160, Value: nil}}
+
+	shiftTimestamps(merged, 60)
+
+	if want := []DataPoint{{Timestamp: 160, Value: 1.0}, {Timestamp: 220, Value: nil}}; !reflect.DeepEqual(merged, want) {
+
+		t.Errorf("merged histogram = %v, want %v", merged, want)
+	}
+
+	grouped := map[uint32][]DataPoint{7: {{Timestamp: 100, Value: 2.0}}}
+
+	shiftTimestamps(grouped, 60)
+
+	if grouped[7][0].Timestamp != 160 {
+
+		t.Errorf("grouped histogram = %v, want its point at 160", grouped)
+	}
+
+	shiftTimestamps(42.0, 60) // gauges hold no timestamps
+}
+
+func TestOffsetsOmitted(t *testing.T) {
+
+	data, err := json.Marshal(Query{CounterID: 1})
+
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	if strings.Contains(string(data), "offsets") {
+
+		t.Errorf("query without offsets encodes them: %s", data)
+	}
+}
@@ -0,0 +1,180 @@
+package reader
+
+import (
+	"context"
+	"encoding/binary"
+	"go.uber.org/zap"
+	"math"
+	. "reportdb/cache"
+	. "reportdb/logger"
+	. "reportdb/utils"
+	"sync"
+	"sync/atomic"
+)
+
+// canStream reports whether a query spanning days is aggregated while reading.
+// Only numeric aggregations, or lists of them, of gauge, grid and histogram
+// queries can be.
+func canStream(query Query, dataType DataType, days int) bool {
+
+	streamDays := GetStreamQueryDays()
+
+	if streamDays <= 0 || days < streamDays {
+
+		return false
+	}
+
+	if query.Type != "" || dataType == TypeString {
+
+		return false
+	}
+
+	aggregations, err := parseAggregations(query.Aggregation)
+
+	if err != nil {
+
+		return false
+	}
+
+	for _, aggregation := range aggregations {
+
+		if !isNumericAggregation(aggregation) {
+
+			return false
+		}
+	}
+
+	return true
+}
+
+// streamData folds the points of every object straight into the accumulators
+// of its buckets, one day at a time, so no raw series is ever held. Cached days
+// are folded from the cache, the others are scanned and left out of the cache,
+// so a long query doesn't evict the days dashboards keep reading. Folded points
+// are charged to budget like fetched ones.
+func (reader *Reader) streamData(ctx context.Context, query Query, dataType DataType, plans []dayPlan, budget *pointsBudget) error {
+
+	starts := []uint32{query.From} // gauge and grid queries fold into one bucket
+
+	if isHistogram(query) {
+
+		var err error
+
+		if starts, err = getBucketStarts(query); err != nil {
+
+			return err
+		}
+	}
+
+	objectDays := make(map[uint32][]dayPlan)
+
+	for _, plan := range plans {
+
+		for _, objectID := range plan.objects {
+
+			objectDays[objectID] = append(objectDays[objectID], plan)
+		}
+	}
+
+	wg := &sync.WaitGroup{}
+
+	// object workers stop scanning once ctx is done, so waiting is bounded
+	defer wg.Wait()
+
+	for objectID, days := range objectDays {
+
+		select {
+
+		case <-ctx.Done():
+
+			return nil
+
+		case <-reader.objectPool:
+		}
+
+		wg.Add(1)
+
+		go func(objectID uint32, days []dayPlan) {
+
+			defer func() {
+
+				wg.Done()
+
+				reader.objectPool <- struct{}{}
+			}()
+
+			folder := newBucketFolder(starts, query.From, query.To, make([]accumulator, len(starts)))
+
+			for _, plan := range days {
+
+				if err := reader.streamDay(ctx, plan, objectID, dataType, folder, budget); err != nil {
+
+					if ctx.Err() != nil {
+
+						return
+					}
+
+					Logger.Error("Scan failed", zap.Error(err), zap.Uint32("object_id", objectID))
+				}
+			}
+
+			atomic.AddInt64(&reader.stats.Points, folder.points)
+
+			if folder.points == 0 {
+
+				return
+			}
+
+			reader.fetchLock.Lock()
+
+			reader.aggregates[objectID] = folder.accumulators
+
+			reader.fetchLock.Unlock()
+
+		}(objectID, days)
+	}
+
+	return nil
+}
+
+// streamDay folds the points of one object for the day of plan and charges
+// them to budget.
+func (reader *Reader) streamDay(ctx context.Context, plan dayPlan, objectID uint32, dataType DataType, folder *bucketFolder, budget *pointsBudget) error {
+
+	folded := folder.points
+
+	defer func() { budget.spend(int(folder.points - folded)) }()
+
+	if series, hit := PeekSeries(plan.path, objectID); hit {
+
+		atomic.AddInt64(&reader.stats.CacheHits, 1)
+
+		series.View(folder.addColumns)
+
+		return nil
+	}
+
+	atomic.AddInt64(&reader.stats.CacheMisses, 1)
+
+	decoded := int64(0)
+
+	err := plan.store.Scan(ctx, objectID, folder.from, folder.to, reader.stats, func(record []byte) {
+
+		bits := binary.LittleEndian.Uint64(record[4:])
+
+		value := math.Float64frombits(bits)
+
+		if dataType == TypeUint64 {
+
+			value = float64(bits)
+		}
+
+		folder.add(binary.LittleEndian.Uint32(record[:4]), value)
+
+		decoded++
+	})
+
+	atomic.AddInt64(&reader.stats.RecordsDecoded, decoded)
+
+	return err
+}
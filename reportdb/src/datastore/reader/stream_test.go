@@ -0,0 +1,74 @@
+package reader
+
+import (
+	"context"
+	. "reportdb/cache"
+	. "reportdb/utils"
+	"testing"
+)
+
+func TestStreamDaySpendsBudget(t *testing.T) {
+
+	if err := InitCache(); err != nil {
+
+		t.Fatal(err)
+	}
+
+	_, _, err := LoadSeries("stream_test/counter_1", 1, func() (Columns, error) {
+
+		columns := NewColumns(TypeFloat64, 5)
+
+		for timestamp := uint32(10); timestamp <= 50; timestamp += 10 {
+
+			columns.Append(timestamp, float64(timestamp))
+		}
+
+		return columns, nil
+	})
+
+	if err != nil {
+
+		t.Fatal(err)
+	}
+
+	reader := &Reader{stats: &QueryStats{}}
+
+	plan := dayPlan{path: "stream_test/counter_1"}
+
+	tests := []struct {
+		name string
+
+		max int64
+
+		to uint32 // the points after it aren't folded nor charged
+
+		exceeded bool
+	}{
+		{"within the limit", 5, 50, false},
+
+		{"past the limit", 4, 50, true},
+
+		{"range within the limit", 3, 30, false},
+	}
+
+	for _, test := range tests {
+
+		ctx, cancel := context.WithCancelCause(context.Background())
+
+		budget := &pointsBudget{max: test.max, cancel: cancel}
+
+		folder := newBucketFolder([]uint32{0}, 0, test.to, make([]accumulator, 1))
+
+		if err := reader.streamDay(ctx, plan, 1, TypeFloat64, folder, budget); err != nil {
+
+			t.Fatal(err)
+		}
+
+		if exceeded := GetErrorCode(context.Cause(ctx)) == ErrQueryTooLarge; exceeded != test.exceeded {
+
+			t.Errorf("%s: limit exceeded = %v, want %v", test.name, exceeded, test.exceeded)
+		}
+
+		cancel(nil)
+	}
+}
@@ -0,0 +1,350 @@
+package reader
+
+import (
+	. "reportdb/utils"
+	"sort"
+	"strings"
+)
+
+const (
+	aggLast = "LAST"
+
+	aggFirst = "FIRST"
+
+	aggDistinct = "DISTINCT"
+
+	aggCountDistinct = "COUNT_DISTINCT"
+
+	aggMode = "MODE"
+
+	aggChanges = "CHANGES"
+)
+
+// valueChange is one entry of a CHANGES result. ObjectID is only set when
+// the changes of several objects are merged.
+type valueChange struct {
+	Timestamp uint32 `json:"timestamp"`
+
+	ObjectID uint32 `json:"object_id,omitempty"`
+
+	From interface{} `json:"from"`
+
+	To interface{} `json:"to"`
+}
+
+func isStringAggregation(aggregation string) bool {
+
+	switch strings.ToUpper(aggregation) {
+
+	case aggLast, aggFirst, aggDistinct, aggCountDistinct, aggMode, aggChanges:
+
+		return true
+	}
+
+	return false
+}
+
+// StringQuery runs the value aggregations (LAST, FIRST, DISTINCT,
+// COUNT_DISTINCT, MODE, CHANGES), meant for string counters such as
+// hostnames but valid for any type, as gauge, grid or histogram query.
+func (reader *Reader) StringQuery(query Query) (interface{}, error) {
+
+	aggregation := strings.ToUpper(query.Aggregation)
+
+	for _, columns := range reader.results {
+
+		columns.Sort()
+	}
+
+	results := reader.getPoints()
+
+	if !isHistogram(query) {
+
+		if query.GroupByObjects {
+
+			grid := make(map[uint32]interface{}, len(results))
+
+			for objectID, points := range results {
+
+				grid[objectID] = aggregateSeries(points, aggregation, nil)
+			}
+
+			return grid, nil
+		}
+
+		return aggregateObjects(results, aggregation, nil), nil
+	}
+
+	if query.Fill == "" {
+
+		query.Fill = fillNull // a zero is no sensible stand-in for a missing string
+	}
+
+	fill, err := parseFillPolicy(query.Fill)
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	starts, err := getBucketStarts(query)
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	bucketed := make(map[uint32][]DataPoint, len(results))
+
+	merged := make([]DataPoint, len(starts))
+
+	bucketPoints := make(map[uint32][]DataPoint, len(results))
+
+	previous := make(map[uint32]interface{}, len(results)) // last value of each object before the bucket
+
+	remaining := make(map[uint32][]DataPoint, len(results))
+
+	for objectID, points := range results {
+
+		bucketed[objectID] = make([]DataPoint, len(starts))
+
+		remaining[objectID] = points
+	}
+
+	for i, start := range starts {
+
+		end := query.To
+
+		if i+1 < len(starts) && starts[i+1]-1 < end {
+
+			end = starts[i+1] - 1
+		}
+
+		for objectID, points := range remaining {
+
+			first := sort.Search(len(points), func(j int) bool { return points[j].Timestamp >= start })
+
+			last := sort.Search(len(points), func(j int) bool { return points[j].Timestamp > end })
+
+			bucketPoints[objectID] = points[first:last]
+
+			remaining[objectID] = points[last:]
+		}
+
+		if query.GroupByObjects {
+
+			for objectID, points := range bucketPoints {
+
+				bucketed[objectID][i] = DataPoint{
+
+					Timestamp: start,
+
+					Value: aggregateSeries(points, aggregation, previous[objectID]),
+				}
+			}
+		}
+
+		merged[i] = DataPoint{
+
+			Timestamp: start,
+
+			Value: aggregateObjects(bucketPoints, aggregation, previous),
+		}
+
+		for objectID, points := range bucketPoints {
+
+			if len(points) > 0 {
+
+				previous[objectID] = points[len(points)-1].Value
+			}
+		}
+	}
+
+	if query.GroupByObjects {
+
+		for _, points := range bucketed {
+
+			fillGaps(points, fill)
+		}
+
+		return bucketed, nil
+	}
+
+	fillGaps(merged, fill)
+
+	return merged, nil
+}
+
+// aggregateObjects aggregates the points of several objects as one series.
+// CHANGES is computed per object, since the values of different objects
+// interleave, and the changes are merged by timestamp.
+func aggregateObjects(series map[uint32][]DataPoint, aggregation string, previous map[uint32]interface{}) interface{} {
+
+	if aggregation == aggChanges {
+
+		var changes []valueChange
+
+		found := false
+
+		for objectID, points := range series {
+
+			if len(points) == 0 {
+
+				continue
+			}
+
+			found = true
+
+			for _, change := range getChanges(points, previous[objectID]) {
+
+				change.ObjectID = objectID
+
+				changes = append(changes, change)
+			}
+		}
+
+		if !found {
+
+			return nil
+		}
+
+		sort.Slice(changes, func(i, j int) bool {
+
+			if changes[i].Timestamp != changes[j].Timestamp {
+
+				return changes[i].Timestamp < changes[j].Timestamp
+			}
+
+			return changes[i].ObjectID < changes[j].ObjectID
+		})
+
+		if changes == nil {
+
+			changes = []valueChange{}
+		}
+
+		return changes
+	}
+
+	var all []DataPoint
+
+	for _, points := range series {
+
+		all = append(all, points...)
+	}
+
+	sort.SliceStable(all, func(i, j int) bool {
+
+		return all[i].Timestamp < all[j].Timestamp
+	})
+
+	return aggregateSeries(all, aggregation, nil)
+}
+
+// aggregateSeries aggregates points sorted by timestamp. previous is the value
+// before the first point, so CHANGES can report a change at the first point.
+// It returns nil when there are no points, like aggregateValues.
+func aggregateSeries(points []DataPoint, aggregation string, previous interface{}) interface{} {
+
+	if len(points) == 0 {
+
+		return nil
+	}
+
+	switch aggregation {
+
+	case aggLast:
+
+		return points[len(points)-1].Value
+
+	case aggFirst:
+
+		return points[0].Value
+
+	case aggDistinct:
+
+		distinct, _ := countValues(points)
+
+		return distinct
+
+	case aggCountDistinct:
+
+		distinct, _ := countValues(points)
+
+		return len(distinct)
+
+	case aggMode:
+
+		distinct, counts := countValues(points)
+
+		mode := distinct[0]
+
+		for _, value := range distinct[1:] { // ties go to the value seen first
+
+			if counts[value] > counts[mode] {
+
+				mode = value
+			}
+		}
+
+		return mode
+
+	case aggChanges:
+
+		changes := getChanges(points, previous)
+
+		if changes == nil {
+
+			changes = []valueChange{}
+		}
+
+		return changes
+	}
+
+	return nil
+}
+
+// countValues returns the distinct values in order of first appearance and
+// the number of points holding each of them.
+func countValues(points []DataPoint) ([]interface{}, map[interface{}]int) {
+
+	var distinct []interface{}
+
+	counts := make(map[interface{}]int)
+
+	for _, point := range points {
+
+		if counts[point.Value] == 0 {
+
+			distinct = append(distinct, point.Value)
+		}
+
+		counts[point.Value]++
+	}
+
+	return distinct, counts
+}
+
+func getChanges(points []DataPoint, previous interface{}) []valueChange {
+
+	var changes []valueChange
+
+	for _, point := range points {
+
+		if previous != nil && point.Value != previous {
+
+			changes = append(changes, valueChange{
+
+				Timestamp: point.Timestamp,
+
+				From: previous,
+
+				To: point.Value,
+			})
+		}
+
+		previous = point.Value
+	}
+
+	return changes
+}
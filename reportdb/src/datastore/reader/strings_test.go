@@ -0,0 +1,138 @@
+package reader
+
+import (
+	"reflect"
+	. "reportdb/utils"
+	"testing"
+)
+
+func TestGetChanges(t *testing.T) {
+
+	points := func(values ...string) []DataPoint {
+
+		result := make([]DataPoint, len(values))
+
+		for i, value := range values {
+
+			result[i] = DataPoint{Timestamp: uint32(i * 10), Value: value}
+		}
+
+		return result
+	}
+
+	tests := []struct {
+		name string
+
+		points []DataPoint
+
+		previous interface{}
+
+		want []valueChange
+	}{
+		{"no points", nil, "up", nil},
+
+		{"single value", points("up", "up", "up"), nil, nil},
+
+		{"changes", points("up", "down", "down", "up"), nil, []valueChange{{Timestamp: 10, From: "up", To: "down"}, {Timestamp: 30, From: "down", To: "up"}}},
+
+		{"change at the first point", points("down", "down"), "up", []valueChange{{Timestamp: 0, From: "up", To: "down"}}},
+
+		{"same as before", points("up"), "up", nil},
+	}
+
+	for _, test := range tests {
+
+		if got := getChanges(test.points, test.previous); !reflect.DeepEqual(got, test.want) {
+
+			t.Errorf("%s: getChanges = %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestStringQuery(t *testing.T) {
+
+	load := func(reader *Reader) {
+
+		series := map[uint32][]string{
+
+			1: {"up", "up", "down", "down", "up"}, // at 0, 10, 20, 30 and 40
+
+			2: {"a", "a"},
+		}
+
+		for objectID, values := range series {
+
+			columns := NewColumns(TypeString, len(values))
+
+			for i, value := range values {
+
+				columns.Append(uint32(i*10)+(objectID-1)*5, value)
+			}
+
+			reader.results[objectID] = &columns
+		}
+	}
+
+	tests := []struct {
+		name string
+
+		query Query
+
+		want interface{}
+	}{
+		{
+			name: "changes",
+
+			query: Query{Aggregation: "changes", From: 0, To: 59},
+
+			want: []valueChange{{Timestamp: 20, ObjectID: 1, From: "up", To: "down"}, {Timestamp: 40, ObjectID: 1, From: "down", To: "up"}},
+		},
+		{
+			name: "changes per bucket",
+
+			query: Query{Aggregation: "changes", From: 0, To: 59, Interval: 20},
+
+			// the first value of a bucket is compared with the last one before it
+			want: []DataPoint{
+				{Timestamp: 0, Value: []valueChange{}},
+				{Timestamp: 20, Value: []valueChange{{Timestamp: 20, ObjectID: 1, From: "up", To: "down"}}},
+				{Timestamp: 40, Value: []valueChange{{Timestamp: 40, ObjectID: 1, From: "down", To: "up"}}},
+			},
+		},
+		{
+			name: "count distinct per object",
+
+			query: Query{Aggregation: "count_distinct", GroupByObjects: true},
+
+			want: map[uint32]interface{}{1: 2, 2: 1},
+		},
+		{
+			name: "mode",
+
+			query: Query{Aggregation: "mode", GroupByObjects: true},
+
+			want: map[uint32]interface{}{1: "up", 2: "a"},
+		},
+		{
+			name: "empty range",
+
+			query: Query{Aggregation: "changes", From: 100, To: 139, Interval: 20},
+
+			want: []DataPoint{{Timestamp: 100}, {Timestamp: 120}},
+		},
+	}
+
+	for _, test := range tests {
+
+		reader := newReader(nil)
+
+		load(reader)
+
+		got, err := reader.StringQuery(test.query)
+
+		if err != nil || !reflect.DeepEqual(got, test.want) {
+
+			t.Errorf("%s: StringQuery = %+v, %v, want %+v", test.name, got, err, test.want)
+		}
+	}
+}
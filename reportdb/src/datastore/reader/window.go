@@ -0,0 +1,156 @@
+package reader
+
+import (
+	. "reportdb/utils"
+	"strings"
+)
+
+const (
+	windowMovingAverage = "moving_avg"
+
+	windowMovingSum = "moving_sum"
+
+	windowEWMA = "ewma"
+
+	windowCumulativeSum = "cumsum"
+
+	defaultWindowSize = 5
+
+	defaultWindowAlpha = 0.3
+)
+
+func getWindowOptions(query Query) (WindowOptions, error) {
+
+	options := *query.Window
+
+	if query.Type != "" || !isHistogram(query) {
+
+		return options, NewQueryError(ErrInvalidQuery, "window functions need a histogram query")
+	}
+
+	aggregations, err := parseAggregations(query.Aggregation)
+
+	if err != nil {
+
+		return options, err
+	}
+
+	for _, aggregation := range aggregations {
+
+		if !isNumericAggregation(aggregation) {
+
+			return options, NewQueryError(ErrInvalidQuery, "window functions need avg, min, max or sum aggregations, got %q", query.Aggregation)
+		}
+	}
+
+	options.Function = strings.ToLower(options.Function)
+
+	switch options.Function {
+
+	case windowMovingAverage, windowMovingSum, windowEWMA, windowCumulativeSum:
+
+	default:
+
+		return options, NewQueryError(ErrInvalidQuery, "invalid window function %q, expected moving_avg, moving_sum, ewma or cumsum", options.Function)
+	}
+
+	if options.Size == 0 {
+
+		options.Size = defaultWindowSize
+	}
+
+	if options.Alpha == 0 {
+
+		options.Alpha = defaultWindowAlpha
+	}
+
+	if options.Size < 1 || options.Alpha < 0 || options.Alpha > 1 {
+
+		return options, NewQueryError(ErrInvalidQuery, "invalid window options, size must be positive and alpha between 0 and 1")
+	}
+
+	return options, nil
+}
+
+// applyWindow replaces the value of every bucket of one series by the window
+// function over it and the buckets before it. Moving windows span size
+// buckets, the current one included, and skip the empty ones in them. Empty
+// buckets stay empty, to be filled later.
+func applyWindow(points []DataPoint, options WindowOptions) {
+
+	values := make([]float64, len(points))
+
+	present := make([]bool, len(points))
+
+	for i, point := range points {
+
+		values[i], present[i] = convertToFloat64(point.Value)
+	}
+
+	sum, count := 0.0, 0
+
+	for i := range points {
+
+		switch options.Function {
+
+		case windowMovingAverage, windowMovingSum:
+
+			if present[i] {
+
+				sum += values[i]
+
+				count++
+			}
+
+			if expired := i - options.Size; expired >= 0 && present[expired] {
+
+				sum -= values[expired]
+
+				count--
+			}
+
+			if !present[i] {
+
+				continue
+			}
+
+			points[i].Value = sum
+
+			if options.Function == windowMovingAverage {
+
+				points[i].Value = sum / float64(count)
+			}
+
+		case windowEWMA:
+
+			if !present[i] {
+
+				continue
+			}
+
+			if count == 0 {
+
+				sum = values[i]
+
+			} else {
+
+				sum = options.Alpha*values[i] + (1-options.Alpha)*sum
+			}
+
+			count++
+
+			points[i].Value = sum
+
+		case windowCumulativeSum:
+
+			if !present[i] {
+
+				continue
+			}
+
+			sum += values[i]
+
+			points[i].Value = sum
+		}
+	}
+}
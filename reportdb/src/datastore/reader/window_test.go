@@ -0,0 +1,138 @@
+package reader
+
+import (
+	"reflect"
+	. "reportdb/utils"
+	"testing"
+)
+
+func TestGetWindowOptions(t *testing.T) {
+
+	tests := []struct {
+		name string
+
+		query Query
+
+		want WindowOptions
+
+		code string
+	}{
+		{
+			name: "defaults",
+
+			query: Query{Interval: 60, Aggregation: "AVG", Window: &WindowOptions{Function: "EWMA"}},
+
+			want: WindowOptions{Function: windowEWMA, Size: defaultWindowSize, Alpha: defaultWindowAlpha},
+		},
+		{
+			name: "aggregation list",
+
+			query: Query{Interval: 60, Aggregation: "min,max", Window: &WindowOptions{Function: "moving_sum", Size: 3}},
+
+			want: WindowOptions{Function: windowMovingSum, Size: 3, Alpha: defaultWindowAlpha},
+		},
+		{
+			name: "gauge",
+
+			query: Query{Aggregation: "AVG", Window: &WindowOptions{Function: "cumsum"}},
+
+			code: ErrInvalidQuery,
+		},
+		{
+			name: "raw query",
+
+			query: Query{Type: queryTypeRaw, Interval: 60, Window: &WindowOptions{Function: "cumsum"}},
+
+			code: ErrInvalidQuery,
+		},
+		{
+			name: "string aggregation",
+
+			query: Query{Interval: 60, Aggregation: "LAST", Window: &WindowOptions{Function: "cumsum"}},
+
+			code: ErrInvalidQuery,
+		},
+		{
+			name: "unknown function",
+
+			query: Query{Interval: 60, Aggregation: "AVG", Window: &WindowOptions{Function: "median"}},
+
+			code: ErrInvalidQuery,
+		},
+		{
+			name: "negative size",
+
+			query: Query{Interval: 60, Aggregation: "AVG", Window: &WindowOptions{Function: "moving_avg", Size: -1}},
+
+			code: ErrInvalidQuery,
+		},
+		{
+			name: "alpha above 1",
+
+			query: Query{Interval: 60, Aggregation: "AVG", Window: &WindowOptions{Function: "ewma", Alpha: 1.5}},
+
+			code: ErrInvalidQuery,
+		},
+	}
+
+	for _, test := range tests {
+
+		options, err := getWindowOptions(test.query)
+
+		if test.code != "" {
+
+			if GetErrorCode(err) != test.code {
+
+				t.Errorf("%s: error = %v, want code %s", test.name, err, test.code)
+			}
+
+			continue
+		}
+
+		if err != nil || options != test.want {
+
+			t.Errorf("%s: getWindowOptions = %+v, %v, want %+v", test.name, options, err, test.want)
+		}
+	}
+}
+
+func TestApplyWindow(t *testing.T) {
+
+	points := func(values ...interface{}) []DataPoint {
+
+		result := make([]DataPoint, len(values))
+
+		for i, value := range values {
+
+			result[i] = DataPoint{Timestamp: uint32(i * 60), Value: value}
+		}
+
+		return result
+	}
+
+	tests := []struct {
+		options WindowOptions
+
+		want []DataPoint
+	}{
+		{WindowOptions{Function: windowMovingSum, Size: 2}, points(1.0, 3.0, nil, 4.0, 9.0)},
+
+		{WindowOptions{Function: windowMovingAverage, Size: 2}, points(1.0, 1.5, nil, 4.0, 4.5)},
+
+		{WindowOptions{Function: windowEWMA, Alpha: 0.5}, points(1.0, 1.5, nil, 2.75, 3.875)},
+
+		{WindowOptions{Function: windowCumulativeSum}, points(1.0, 3.0, nil, 7.0, 12.0)},
+	}
+
+	for _, test := range tests {
+
+		got := points(1.0, 2.0, nil, 4.0, 5.0)
+
+		applyWindow(got, test.options)
+
+		if !reflect.DeepEqual(got, test.want) {
+
+			t.Errorf("%s: applyWindow = %v, want %v", test.options.Function, got, test.want)
+		}
+	}
+}
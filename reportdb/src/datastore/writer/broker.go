@@ -1,44 +1,126 @@
 package writer
 
 import (
+	"errors"
 	"go.uber.org/zap"
 	. "reportdb/logger"
 	. "reportdb/utils"
+	"sort"
+	"sync"
 )
 
-func DistributeData(dataChannel chan []Events, writers []*Writer) {
+// batchTracker calls stored, or failed with the events the store failed,
+// once the writers have handled the last event of an acknowledged batch.
+type batchTracker struct {
+	remaining int
+
+	failures []int // indexes of the events to retransmit
+
+	lock sync.Mutex
+
+	stored func()
+
+	failed func(failed []int)
+}
+
+// done records the outcome of the event at index. Rejected events are logged
+// by the writer and count as handled, a retransmission would fail them again.
+func (tracker *batchTracker) done(index int, err error) {
+
+	tracker.lock.Lock()
+
+	if err != nil && !errors.Is(err, errRejected) {
+
+		tracker.failures = append(tracker.failures, index)
+	}
+
+	tracker.remaining--
+
+	last := tracker.remaining == 0
+
+	tracker.lock.Unlock()
+
+	if !last {
+
+		return
+	}
+
+	if len(tracker.failures) > 0 {
+
+		sort.Ints(tracker.failures) // writers finish in any order
+
+		tracker.failed(tracker.failures)
+
+		return
+	}
+
+	tracker.stored()
+}
+
+func DistributeData(dataChannel chan []Events, batchChannel chan Batch, writers []*Writer) {
 
 	go func() {
 
 		defer ShutdownWriters(writers)
 
-		numWriters := uint8(len(writers))
+		for {
+
+			select {
+
+			case batch, ok := <-dataChannel:
 
-		for batch := range dataChannel {
+				if !ok {
 
-			for _, row := range batch {
+					return
+				}
+
+				distributeBatch(batch, nil, writers)
 
-				index := uint8((uint32(row.CounterId) + row.ObjectId) % uint32(numWriters))
+			case batch := <-batchChannel:
 
-				if index >= numWriters || index < 0 {
+				if len(batch.Events) == 0 {
 
-					Logger.Warn("DistributeData: writer index out of range",
-						zap.Uint8("index", index),
-						zap.Uint8("numWriters", numWriters),
-						zap.Uint16("CounterId", row.CounterId),
-						zap.Uint32("ObjectId", row.ObjectId),
-					)
+					batch.Stored()
 
 					continue
 				}
 
-				writers[index].events <- row
+				tracker := &batchTracker{remaining: len(batch.Events), stored: batch.Stored, failed: batch.Failed}
+
+				distributeBatch(batch.Events, tracker, writers)
 			}
 		}
 
-		return
-
 	}()
 
 	return
 }
+
+func distributeBatch(batch []Events, tracker *batchTracker, writers []*Writer) {
+
+	numWriters := uint8(len(writers))
+
+	for i, row := range batch {
+
+		index := uint8((uint32(row.CounterId) + row.ObjectId) % uint32(numWriters))
+
+		if index >= numWriters || index < 0 {
+
+			Logger.Warn("DistributeData: writer index out of range",
+				zap.Uint8("index", index),
+				zap.Uint8("numWriters", numWriters),
+				zap.Uint16("CounterId", row.CounterId),
+				zap.Uint32("ObjectId", row.ObjectId),
+			)
+
+			if tracker != nil {
+
+				tracker.done(i, errRejected) // can't be stored by any writer, retransmitting wouldn't help
+			}
+
+			continue
+		}
+
+		writers[index].events <- writeRequest{row: row, index: i, tracker: tracker}
+	}
+}
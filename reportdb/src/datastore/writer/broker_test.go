@@ -0,0 +1,78 @@
+package writer
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestBatchTracker(t *testing.T) {
+
+	diskFull := errors.New("disk full")
+
+	rejected := fmt.Errorf("%w: unknown counter", errRejected)
+
+	tests := []struct {
+		name string
+
+		errs []error
+
+		stored int
+
+		failed []int
+	}{
+		{"all stored", []error{nil, nil, nil}, 1, nil},
+
+		{"one failed", []error{nil, diskFull, nil}, 0, []int{1}},
+
+		{"all failed", []error{diskFull, diskFull, diskFull}, 0, []int{0, 1, 2}},
+
+		{"rejected events are handled", []error{nil, rejected, nil}, 1, nil},
+
+		{"rejected and failed", []error{rejected, diskFull, nil, diskFull}, 0, []int{1, 3}},
+	}
+
+	for _, test := range tests {
+
+		stored, calls := 0, 0
+
+		var failed []int
+
+		tracker := &batchTracker{
+
+			remaining: len(test.errs),
+
+			stored: func() { stored++ },
+
+			failed: func(indexes []int) {
+
+				calls++
+
+				failed = indexes
+			},
+		}
+
+		var waitGroup sync.WaitGroup
+
+		for i, err := range test.errs { // writers report concurrently
+
+			waitGroup.Add(1)
+
+			go func(i int, err error) {
+
+				defer waitGroup.Done()
+
+				tracker.done(i, err)
+			}(i, err)
+		}
+
+		waitGroup.Wait()
+
+		if stored != test.stored || !reflect.DeepEqual(failed, test.failed) || (test.failed != nil && calls != 1) {
+
+			t.Errorf("%s: stored %d times and failed %v, want %d and %v", test.name, stored, failed, test.stored, test.failed)
+		}
+	}
+}
@@ -70,6 +70,11 @@ func encodeData(row Events, data *[]byte) (uint8, error) {
 			return 0, fmt.Errorf("encodeData : invalid string value for counter %d", row.CounterId)
 		}
 
+		if len(str) > MaxStringLength {
+
+			return 0, fmt.Errorf("encodeData : string of %d bytes for counter %d is longer than %d", len(str), row.CounterId, MaxStringLength)
+		}
+
 		binary.LittleEndian.PutUint32(*data, uint32(len(str)))
 
 		binary.LittleEndian.PutUint32((*data)[4:], row.Timestamp)
@@ -0,0 +1,34 @@
+package writer
+
+import (
+	. "reportdb/utils"
+	"strings"
+	"testing"
+)
+
+func TestEncodeDataStringLength(t *testing.T) {
+
+	if err := RegisterCounterType(900, TypeString); err != nil {
+
+		t.Fatal(err)
+	}
+
+	data := make([]byte, 100)
+
+	longest := strings.Repeat("a", MaxStringLength)
+
+	size, err := encodeData(Events{ObjectId: 1, CounterId: 900, Timestamp: 10, Value: longest}, &data)
+
+	if err != nil || int(size) != len(data) {
+
+		t.Fatalf("encodeData of %d bytes = %d, %v, want %d", MaxStringLength, size, err, len(data))
+	}
+
+	for _, length := range []int{MaxStringLength + 1, 300} {
+
+		if _, err := encodeData(Events{ObjectId: 1, CounterId: 900, Timestamp: 10, Value: strings.Repeat("a", length)}, &data); err == nil {
+
+			t.Errorf("encodeData of %d bytes was accepted", length)
+		}
+	}
+}
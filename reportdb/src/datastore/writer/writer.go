@@ -1,8 +1,11 @@
 package writer
 
 import (
+	"errors"
 	"fmt"
 	"go.uber.org/zap"
+	. "reportdb/cache"
+	. "reportdb/datastore/feed"
 	. "reportdb/logger"
 	. "reportdb/storage"
 	. "reportdb/utils"
@@ -12,18 +15,32 @@ import (
 type Writer struct {
 	id uint8
 
-	events chan Events
+	events chan writeRequest
 
 	storePool *StorePool
 
+	feed *Feed // receives every stored event
+
 	waitGroup *sync.WaitGroup
 
 	data []byte // for serializing data
 }
 
-func StartWriter(storePool *StorePool) ([]*Writer, error) {
+type writeRequest struct {
+	row Events
+
+	index int // of the row in its batch
+
+	tracker *batchTracker // nil unless the batch is acknowledged
+}
+
+// errRejected wraps the failures of rows that can't ever be stored, such as
+// an unknown counter or a value of the wrong type, unlike store failures.
+var errRejected = errors.New("row rejected")
 
-	writers, err := initializeWriters(storePool)
+func StartWriter(storePool *StorePool, feed *Feed) ([]*Writer, error) {
+
+	writers, err := initializeWriters(storePool, feed)
 
 	if err != nil {
 
@@ -38,7 +55,7 @@ func StartWriter(storePool *StorePool) ([]*Writer, error) {
 	return writers, nil
 }
 
-func initializeWriters(storePool *StorePool) ([]*Writer, error) {
+func initializeWriters(storePool *StorePool, feed *Feed) ([]*Writer, error) {
 
 	writers := make([]*Writer, GetWriters())
 
@@ -48,10 +65,12 @@ func initializeWriters(storePool *StorePool) ([]*Writer, error) {
 
 			id: uint8(i),
 
-			events: make(chan Events, GetEventsBuffer()),
+			events: make(chan writeRequest, GetEventsBuffer()),
 
 			storePool: storePool,
 
+			feed: feed,
+
 			waitGroup: &sync.WaitGroup{},
 
 			data: make([]byte, 100),
@@ -69,56 +88,87 @@ func (writer *Writer) runWriter(workingDirectory string) {
 
 		defer writer.waitGroup.Done()
 
-		for row := range writer.events {
-
-			store, err := writer.storePool.GetEngine(getPath(workingDirectory, row), true)
+		for request := range writer.events {
 
-			if err != nil {
+			err := writer.write(workingDirectory, request.row)
 
-				Logger.Error("Writer: error getting store",
-					zap.Uint8("writer_id", writer.id),
-					zap.Uint32("object_id", row.ObjectId),
-					zap.Uint16("counter_id", row.CounterId),
-					zap.Error(err),
-				)
+			if request.tracker != nil {
 
-				continue
+				request.tracker.done(request.index, err)
 			}
+		}
 
-			lastIndex, err := encodeData(row, &writer.data)
+		return
 
-			if err != nil {
+	}(writer)
+}
 
-				Logger.Error("Writer: failed to encode data",
-					zap.Uint8("writer_id", writer.id),
-					zap.Uint32("object_id", row.ObjectId),
-					zap.Uint16("counter_id", row.CounterId),
-					zap.Error(err),
-				)
+// write stores row. Failures are logged and returned, the row is skipped.
+// Encoding failures wrap errRejected.
+func (writer *Writer) write(workingDirectory string, row Events) error {
 
-				continue
-			}
+	path := getPath(workingDirectory, row)
 
-			err = store.Put(row.ObjectId, writer.data[:lastIndex])
+	store, err := writer.storePool.GetEngine(path, true)
 
-			if err != nil {
+	if err != nil {
 
-				Logger.Error("Writer: failed to write data",
-					zap.Uint8("writer_id", writer.id),
-					zap.Uint32("object_id", row.ObjectId),
-					zap.Uint16("counter_id", row.CounterId),
-					zap.Uint8("data_bytes", lastIndex),
-					zap.Error(err),
-				)
+		Logger.Error("Writer: error getting store",
+			zap.Uint8("writer_id", writer.id),
+			zap.Uint32("object_id", row.ObjectId),
+			zap.Uint16("counter_id", row.CounterId),
+			zap.Error(err),
+		)
 
-				continue
-			}
+		return err
+	}
 
-		}
+	lastIndex, err := encodeData(row, &writer.data)
 
-		return
+	if err != nil {
 
-	}(writer)
+		Logger.Error("Writer: failed to encode data",
+			zap.Uint8("writer_id", writer.id),
+			zap.Uint32("object_id", row.ObjectId),
+			zap.Uint16("counter_id", row.CounterId),
+			zap.Error(err),
+		)
+
+		return fmt.Errorf("%w: %v", errRejected, err)
+	}
+
+	point := DataPoint{
+
+		Timestamp: row.Timestamp,
+
+		Value: row.Value,
+	}
+
+	err = WriteThrough(path, row.ObjectId, point, func() error {
+
+		return store.Put(row.ObjectId, writer.data[:lastIndex])
+	})
+
+	if err != nil {
+
+		Logger.Error("Writer: failed to write data",
+			zap.Uint8("writer_id", writer.id),
+			zap.Uint32("object_id", row.ObjectId),
+			zap.Uint16("counter_id", row.CounterId),
+			zap.Uint8("data_bytes", lastIndex),
+			zap.Error(err),
+		)
+
+		return err
+	}
+
+	writer.storePool.GetRegistry().Touch(row.CounterId, row.ObjectId, row.Timestamp)
+
+	writer.storePool.GetLatest().Update(row.CounterId, row.ObjectId, row.Timestamp, row.Value)
+
+	writer.feed.Publish(row)
+
+	return nil
 }
 
 func ShutdownWriters(writers []*Writer) {
@@ -0,0 +1,54 @@
+package ingest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseGraphite parses one line of the Graphite plaintext protocol,
+// path value [timestamp]. Node objectNode of the dotted path names the object
+// and the other nodes, joined again, the counter, so web01.cpu.load with
+// objectNode 0 is counter cpu.load of object web01.
+func parseGraphite(line string, objectNode int, now time.Time) (sample, error) {
+
+	fields := strings.Fields(line)
+
+	if len(fields) < 2 || len(fields) > 3 {
+
+		return sample{}, fmt.Errorf("expected path, value and an optional timestamp")
+	}
+
+	nodes := strings.Split(fields[0], ".")
+
+	if objectNode >= len(nodes) || len(nodes) < 2 {
+
+		return sample{}, fmt.Errorf("path %q has no node %d naming the object and a counter", fields[0], objectNode)
+	}
+
+	value, err := strconv.ParseFloat(fields[1], 64)
+
+	if err != nil {
+
+		return sample{}, fmt.Errorf("invalid value %q", fields[1])
+	}
+
+	timestamp := uint32(now.Unix())
+
+	if len(fields) == 3 && fields[2] != "-1" { // -1 asks for the time of arrival
+
+		seconds, err := strconv.ParseFloat(fields[2], 64)
+
+		if err != nil || seconds < 0 || seconds > float64(^uint32(0)) {
+
+			return sample{}, fmt.Errorf("invalid timestamp %q", fields[2])
+		}
+
+		timestamp = uint32(seconds)
+	}
+
+	counter := strings.Join(append(nodes[:objectNode:objectNode], nodes[objectNode+1:]...), ".")
+
+	return sample{counter: counter, object: nodes[objectNode], timestamp: timestamp, value: value}, nil
+}
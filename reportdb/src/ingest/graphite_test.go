@@ -0,0 +1,65 @@
+package ingest
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseGraphite(t *testing.T) {
+
+	now := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		line string
+
+		objectNode int
+
+		want sample
+
+		fails bool
+	}{
+		{line: "web01.cpu.load 1.5 1600000000", want: sample{counter: "cpu.load", object: "web01", timestamp: 1600000000, value: 1.5}},
+
+		{line: "servers.web01.cpu 2 1600000000", objectNode: 1, want: sample{counter: "servers.cpu", object: "web01", timestamp: 1600000000, value: 2.0}},
+
+		{line: "web01.cpu 2", want: sample{counter: "cpu", object: "web01", timestamp: 1700000000, value: 2.0}},
+
+		{line: "web01.cpu 2 -1", want: sample{counter: "cpu", object: "web01", timestamp: 1700000000, value: 2.0}},
+
+		{line: "web01.cpu\t2\t1600000000.9", want: sample{counter: "cpu", object: "web01", timestamp: 1600000000, value: 2.0}},
+
+		{line: "cpu 1", fails: true}, // no counter besides the object
+
+		{line: "web01.cpu 1", objectNode: 2, fails: true},
+
+		{line: "web01.cpu one", fails: true},
+
+		{line: "web01.cpu 1 4294967296", fails: true},
+
+		{line: "web01.cpu 1 -2", fails: true},
+
+		{line: "web01.cpu", fails: true},
+
+		{line: "web01.cpu 1 2 3", fails: true},
+	}
+
+	for _, test := range tests {
+
+		got, err := parseGraphite(test.line, test.objectNode, now)
+
+		if test.fails {
+
+			if err == nil {
+
+				t.Errorf("parseGraphite(%q) = %+v, want an error", test.line, got)
+			}
+
+			continue
+		}
+
+		if err != nil || got != test.want {
+
+			t.Errorf("parseGraphite(%q) = %+v, %v, want %+v", test.line, got, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package ingest
+
+import (
+	"fmt"
+	"math"
+	. "reportdb/utils"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var precisions = map[string]int64{
+
+	"": int64(time.Second / time.Nanosecond),
+
+	"ns": int64(time.Second / time.Nanosecond),
+
+	"us": int64(time.Second / time.Microsecond),
+
+	"ms": int64(time.Second / time.Millisecond),
+
+	"s": 1,
+}
+
+// parseInflux parses one line of InfluxDB line protocol,
+// measurement[,tag=value...] field=value[,field=value...] [timestamp], into a
+// sample per field. The counter is named measurement.field, the object by the
+// value of objectTag.
+func parseInflux(line string, objectTag string, precision string, now time.Time) ([]sample, error) {
+
+	sections := splitUnescaped(line, ' ', true)
+
+	if len(sections) < 2 || len(sections) > 3 {
+
+		return nil, fmt.Errorf("expected measurement, fields and an optional timestamp")
+	}
+
+	timestamp := uint32(now.Unix())
+
+	if len(sections) == 3 {
+
+		value, err := strconv.ParseInt(sections[2], 10, 64)
+
+		if err != nil || value < 0 || value/precisions[precision] > math.MaxUint32 {
+
+			return nil, fmt.Errorf("invalid timestamp %q", sections[2])
+		}
+
+		timestamp = uint32(value / precisions[precision])
+	}
+
+	series := splitUnescaped(sections[0], ',', false)
+
+	measurement := unescape(series[0])
+
+	object := ""
+
+	for _, tag := range series[1:] {
+
+		key, value, found := cutUnescaped(tag, '=')
+
+		if !found {
+
+			return nil, fmt.Errorf("invalid tag %q", tag)
+		}
+
+		if unescape(key) == objectTag {
+
+			object = unescape(value)
+		}
+	}
+
+	if measurement == "" || object == "" {
+
+		return nil, fmt.Errorf("missing measurement or %s tag", objectTag)
+	}
+
+	var samples []sample
+
+	for _, field := range splitUnescaped(sections[1], ',', true) {
+
+		key, text, found := cutUnescaped(field, '=')
+
+		if !found {
+
+			return nil, fmt.Errorf("invalid field %q", field)
+		}
+
+		value, err := parseFieldValue(text)
+
+		if err != nil {
+
+			return nil, fmt.Errorf("field %q: %v", unescape(key), err)
+		}
+
+		samples = append(samples, sample{
+
+			counter: measurement + "." + unescape(key),
+
+			object: object,
+
+			timestamp: timestamp,
+
+			value: value,
+		})
+	}
+
+	return samples, nil
+}
+
+// parseFieldValue parses a float, an integer (5i), an unsigned integer (5u),
+// a quoted string of up to MaxStringLength bytes or a boolean, which is
+// stored as 0 or 1.
+func parseFieldValue(text string) (interface{}, error) {
+
+	switch {
+
+	case len(text) >= 2 && text[0] == '"' && text[len(text)-1] == '"':
+
+		value := strings.NewReplacer(`\"`, `"`, `\\`, `\`).Replace(text[1 : len(text)-1])
+
+		if len(value) > MaxStringLength {
+
+			return nil, fmt.Errorf("string of %d bytes is longer than %d", len(value), MaxStringLength)
+		}
+
+		return value, nil
+
+	case strings.HasSuffix(text, "i"):
+
+		value, err := strconv.ParseInt(strings.TrimSuffix(text, "i"), 10, 64)
+
+		if err == nil && value < 0 {
+
+			return float64(value), nil // uint64 counters can't hold it
+		}
+
+		return uint64(value), err
+
+	case strings.HasSuffix(text, "u"):
+
+		return strconv.ParseUint(strings.TrimSuffix(text, "u"), 10, 64)
+	}
+
+	switch text {
+
+	case "t", "T", "true", "True", "TRUE":
+
+		return uint64(1), nil
+
+	case "f", "F", "false", "False", "FALSE":
+
+		return uint64(0), nil
+	}
+
+	return strconv.ParseFloat(text, 64)
+}
+
+// splitUnescaped splits s at every sep not escaped by a backslash and, when
+// quoted is set, not within double quotes.
+func splitUnescaped(s string, sep byte, quoted bool) []string {
+
+	var parts []string
+
+	start, inQuotes := 0, false
+
+	for i := 0; i < len(s); i++ {
+
+		switch {
+
+		case s[i] == '\\':
+
+			i++
+
+		case s[i] == '"' && quoted:
+
+			inQuotes = !inQuotes
+
+		case s[i] == sep && !inQuotes:
+
+			parts = append(parts, s[start:i])
+
+			start = i + 1
+		}
+	}
+
+	return append(parts, s[start:])
+}
+
+func cutUnescaped(s string, sep byte) (string, string, bool) {
+
+	parts := splitUnescaped(s, sep, false)
+
+	if len(parts) < 2 {
+
+		return s, "", false
+	}
+
+	return parts[0], s[len(parts[0])+1:], true
+}
+
+func unescape(s string) string {
+
+	if !strings.Contains(s, `\`) {
+
+		return s
+	}
+
+	var builder strings.Builder
+
+	for i := 0; i < len(s); i++ {
+
+		if s[i] == '\\' && i+1 < len(s) {
+
+			i++
+		}
+
+		builder.WriteByte(s[i])
+	}
+
+	return builder.String()
+}
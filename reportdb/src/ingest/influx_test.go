@@ -0,0 +1,124 @@
+package ingest
+
+import (
+	"reflect"
+	. "reportdb/utils"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseInflux(t *testing.T) {
+
+	now := time.Unix(1700000000, 0)
+
+	at := func(counter string, object string, timestamp uint32, value interface{}) sample {
+
+		return sample{counter: counter, object: object, timestamp: timestamp, value: value}
+	}
+
+	tests := []struct {
+		line string
+
+		precision string
+
+		want []sample
+	}{
+		{
+			line: `cpu,host=web01,region=eu usage=12.5,count=3i,up=true,name="a b" 1600000000000000000`,
+
+			want: []sample{
+				at("cpu.usage", "web01", 1600000000, 12.5),
+				at("cpu.count", "web01", 1600000000, uint64(3)),
+				at("cpu.up", "web01", 1600000000, uint64(1)),
+				at("cpu.name", "web01", 1600000000, "a b"),
+			},
+		},
+		{line: `cpu,host=web01 usage=1`, want: []sample{at("cpu.usage", "web01", 1700000000, 1.0)}},
+
+		{line: `cpu,host=web01 usage=1 1600000000`, precision: "s", want: []sample{at("cpu.usage", "web01", 1600000000, 1.0)}},
+
+		{line: `cpu,host=web01 usage=1 1600000000123`, precision: "ms", want: []sample{at("cpu.usage", "web01", 1600000000, 1.0)}},
+
+		{line: `my\ cpu,host=web\,01 load\ avg=1`, want: []sample{at("my cpu.load avg", "web,01", 1700000000, 1.0)}},
+
+		{line: `cpu,host=a v=-3i,w=5u,x="say \"hi\""`, want: []sample{at("cpu.v", "a", 1700000000, -3.0), at("cpu.w", "a", 1700000000, uint64(5)), at("cpu.x", "a", 1700000000, `say "hi"`)}},
+
+		{line: `cpu v=1`}, // no host tag
+
+		{line: `cpu,host=a v=1 soon`},
+
+		{line: `cpu,host=a v=1 -1`},
+
+		{line: `cpu,host=a v=1 4294967296`, precision: "s"}, // past 2106
+
+		{line: `cpu,host=a v=1 4294967296000000000`},
+
+		{line: `cpu,host=a v=1 1 2`},
+
+		{line: `cpu,host=a`},
+
+		{line: `cpu,host=a v`},
+
+		{line: `cpu,host=a v=abc`},
+
+		{line: `cpu,host v=1`},
+
+		{line: `cpu,host=a v="` + strings.Repeat("a", MaxStringLength) + `"`, want: []sample{at("cpu.v", "a", 1700000000, strings.Repeat("a", MaxStringLength))}},
+
+		{line: `cpu,host=a v="` + strings.Repeat("a", MaxStringLength+1) + `"`},
+	}
+
+	for _, test := range tests {
+
+		got, err := parseInflux(test.line, "host", test.precision, now)
+
+		if test.want == nil {
+
+			if err == nil {
+
+				t.Errorf("parseInflux(%q) = %v, want an error", test.line, got)
+			}
+
+			continue
+		}
+
+		if err != nil || !reflect.DeepEqual(got, test.want) {
+
+			t.Errorf("parseInflux(%q) = %v, %v, want %v", test.line, got, err, test.want)
+		}
+	}
+}
+
+func TestSplitUnescaped(t *testing.T) {
+
+	tests := []struct {
+		s string
+
+		quoted bool
+
+		want []string
+	}{
+		{"a,b,c", false, []string{"a", "b", "c"}},
+
+		{`a\,b,c`, false, []string{`a\,b`, "c"}},
+
+		{`x="a,b",y=1`, true, []string{`x="a,b"`, "y=1"}},
+
+		{`x="a,b",y=1`, false, []string{`x="a`, `b"`, "y=1"}},
+
+		{`x="a\",b",y=1`, true, []string{`x="a\",b"`, "y=1"}},
+
+		{"", false, []string{""}},
+
+		{"a,", false, []string{"a", ""}},
+	}
+
+	for _, test := range tests {
+
+		if got := splitUnescaped(test.s, ',', test.quoted); !reflect.DeepEqual(got, test.want) {
+
+			t.Errorf("splitUnescaped(%q, %v) = %q, want %q", test.s, test.quoted, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,403 @@
+package ingest
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"io"
+	"net"
+	"os"
+	. "reportdb/logger"
+	. "reportdb/utils"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	maxBatchEvents = 1000 // events sent to the writers at once
+
+	maxDatagramBytes = 64 * 1024
+
+	reportInterval = 10 * time.Second
+)
+
+// Ingest runs the InfluxDB line protocol and Graphite plaintext listeners,
+// each on TCP and UDP, and feeds the parsed events to the writers.
+type Ingest struct {
+	mapping *Mapping
+
+	dataChannel chan []Events
+
+	listeners []net.Listener
+
+	packetConns []net.PacketConn
+
+	connections map[net.Conn]struct{}
+
+	lock sync.Mutex
+
+	waitGroup sync.WaitGroup
+
+	accepted atomic.Uint64
+
+	rejected atomic.Uint64
+
+	lastError atomic.Value // error text of the last rejected line, for the periodic report
+
+	done chan struct{}
+}
+
+// StartIngest starts the listeners of config/ingest.json, returning a nil
+// Ingest when the file doesn't exist.
+func StartIngest(dataChannel chan []Events) (*Ingest, error) {
+
+	data, err := os.ReadFile(GetWorkingDirectory() + "/config/ingest.json")
+
+	if os.IsNotExist(err) {
+
+		return nil, nil
+	}
+
+	if err != nil {
+
+		return nil, fmt.Errorf("read ingest.json file error: %v", err)
+	}
+
+	var config IngestConfig
+
+	if err := json.Unmarshal(data, &config); err != nil {
+
+		return nil, fmt.Errorf("parse ingest.json file error: %v", err)
+	}
+
+	if _, ok := precisions[config.Precision]; !ok {
+
+		return nil, fmt.Errorf("invalid precision %q, expected ns, us, ms or s", config.Precision)
+	}
+
+	if config.ObjectNode < 0 {
+
+		return nil, fmt.Errorf("invalid objectNode %d", config.ObjectNode)
+	}
+
+	ingest := &Ingest{
+
+		mapping: newMapping(config, GetWorkingDirectory()),
+
+		dataChannel: dataChannel,
+
+		connections: make(map[net.Conn]struct{}),
+
+		done: make(chan struct{}),
+	}
+
+	if err := ingest.mapping.load(); err != nil {
+
+		return nil, err
+	}
+
+	config = ingest.mapping.config // with the defaults
+
+	parsers := map[string]func(line string, now time.Time) ([]sample, error){
+
+		config.InfluxAddress: func(line string, now time.Time) ([]sample, error) {
+
+			return parseInflux(line, config.ObjectTag, config.Precision, now)
+		},
+
+		config.GraphiteAddress: func(line string, now time.Time) ([]sample, error) {
+
+			parsed, err := parseGraphite(line, config.ObjectNode, now)
+
+			return []sample{parsed}, err
+		},
+	}
+
+	if config.InfluxAddress != "" && config.InfluxAddress == config.GraphiteAddress {
+
+		return nil, fmt.Errorf("influxAddress and graphiteAddress must differ")
+	}
+
+	for address, parse := range parsers {
+
+		if address == "" {
+
+			continue
+		}
+
+		if err := ingest.listen(address, parse); err != nil {
+
+			ingest.Shutdown()
+
+			return nil, err
+		}
+	}
+
+	ingest.waitGroup.Add(1)
+
+	go ingest.report()
+
+	return ingest, nil
+}
+
+func (ingest *Ingest) listen(address string, parse func(line string, now time.Time) ([]sample, error)) error {
+
+	listener, err := net.Listen("tcp", address)
+
+	if err != nil {
+
+		return fmt.Errorf("failed to listen on tcp %s: %v", address, err)
+	}
+
+	ingest.listeners = append(ingest.listeners, listener)
+
+	packetConn, err := net.ListenPacket("udp", address)
+
+	if err != nil {
+
+		return fmt.Errorf("failed to listen on udp %s: %v", address, err)
+	}
+
+	ingest.packetConns = append(ingest.packetConns, packetConn)
+
+	ingest.waitGroup.Add(2)
+
+	go ingest.acceptConnections(listener, parse)
+
+	go ingest.receivePackets(packetConn, parse)
+
+	return nil
+}
+
+func (ingest *Ingest) acceptConnections(listener net.Listener, parse func(line string, now time.Time) ([]sample, error)) {
+
+	defer ingest.waitGroup.Done()
+
+	for {
+
+		connection, err := listener.Accept()
+
+		if err != nil {
+
+			if !errors.Is(err, net.ErrClosed) {
+
+				Logger.Warn("Ingest: accept failed", zap.Error(err))
+
+				continue
+			}
+
+			return
+		}
+
+		ingest.lock.Lock()
+
+		ingest.connections[connection] = struct{}{}
+
+		ingest.lock.Unlock()
+
+		ingest.waitGroup.Add(1)
+
+		go ingest.readConnection(connection, parse)
+	}
+}
+
+// readConnection reads lines until the client disconnects. Lines are sent to
+// the writers whenever nothing more is buffered or a batch is full.
+func (ingest *Ingest) readConnection(connection net.Conn, parse func(line string, now time.Time) ([]sample, error)) {
+
+	defer func() {
+
+		ingest.lock.Lock()
+
+		delete(ingest.connections, connection)
+
+		ingest.lock.Unlock()
+
+		connection.Close()
+
+		ingest.waitGroup.Done()
+	}()
+
+	reader := bufio.NewReaderSize(connection, maxDatagramBytes)
+
+	var batch []Events
+
+	for {
+
+		line, err := reader.ReadString('\n')
+
+		batch = ingest.parseLine(line, parse, batch)
+
+		if len(batch) >= maxBatchEvents || (len(batch) > 0 && (err != nil || reader.Buffered() == 0)) {
+
+			ingest.dataChannel <- batch
+
+			batch = nil
+		}
+
+		if err != nil {
+
+			if err != io.EOF && !errors.Is(err, net.ErrClosed) {
+
+				Logger.Warn("Ingest: read failed", zap.String("remote", connection.RemoteAddr().String()), zap.Error(err))
+			}
+
+			return
+		}
+	}
+}
+
+func (ingest *Ingest) receivePackets(packetConn net.PacketConn, parse func(line string, now time.Time) ([]sample, error)) {
+
+	defer ingest.waitGroup.Done()
+
+	buffer := make([]byte, maxDatagramBytes)
+
+	for {
+
+		size, _, err := packetConn.ReadFrom(buffer)
+
+		if err != nil {
+
+			if errors.Is(err, net.ErrClosed) {
+
+				return
+			}
+
+			Logger.Warn("Ingest: receive failed", zap.Error(err))
+
+			continue
+		}
+
+		var batch []Events
+
+		for _, line := range strings.Split(string(buffer[:size]), "\n") {
+
+			batch = ingest.parseLine(line, parse, batch)
+		}
+
+		if len(batch) > 0 {
+
+			ingest.dataChannel <- batch
+		}
+	}
+}
+
+// parseLine appends the events of one line to batch. Invalid lines and
+// unknown names are counted and skipped, they never fail the batch.
+func (ingest *Ingest) parseLine(line string, parse func(line string, now time.Time) ([]sample, error), batch []Events) []Events {
+
+	line = strings.TrimSpace(line)
+
+	if line == "" || strings.HasPrefix(line, "#") {
+
+		return batch
+	}
+
+	samples, err := parse(line, time.Now())
+
+	if err != nil {
+
+		ingest.reject(line, err)
+
+		return batch
+	}
+
+	for _, sample := range samples {
+
+		event, err := ingest.mapping.resolve(sample)
+
+		if err != nil {
+
+			ingest.reject(line, err)
+
+			continue
+		}
+
+		batch = append(batch, event)
+
+		ingest.accepted.Add(1)
+	}
+
+	return batch
+}
+
+func (ingest *Ingest) reject(line string, err error) {
+
+	ingest.rejected.Add(1)
+
+	ingest.lastError.Store(fmt.Sprintf("%v in %q", err, line))
+}
+
+// report logs every reportInterval how many values were rejected since the
+// last report, with the last reason, rather than a line per rejected value.
+func (ingest *Ingest) report() {
+
+	defer ingest.waitGroup.Done()
+
+	ticker := time.NewTicker(reportInterval)
+
+	defer ticker.Stop()
+
+	reported := uint64(0)
+
+	for {
+
+		select {
+
+		case <-ingest.done:
+
+			return
+
+		case <-ticker.C:
+
+			if rejected := ingest.rejected.Load(); rejected > reported {
+
+				Logger.Warn("Ingest: values rejected",
+					zap.Uint64("rejected", rejected-reported),
+					zap.Uint64("accepted", ingest.accepted.Load()),
+					zap.Any("last_error", ingest.lastError.Load()),
+				)
+
+				reported = rejected
+			}
+		}
+	}
+}
+
+// Shutdown closes the listeners and open connections and waits for the lines
+// being read to reach the writers.
+func (ingest *Ingest) Shutdown() {
+
+	if ingest == nil {
+
+		return
+	}
+
+	close(ingest.done)
+
+	for _, listener := range ingest.listeners {
+
+		listener.Close()
+	}
+
+	for _, packetConn := range ingest.packetConns {
+
+		packetConn.Close()
+	}
+
+	ingest.lock.Lock()
+
+	for connection := range ingest.connections {
+
+		connection.Close()
+	}
+
+	ingest.lock.Unlock()
+
+	ingest.waitGroup.Wait()
+}
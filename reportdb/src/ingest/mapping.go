@@ -0,0 +1,345 @@
+package ingest
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	. "reportdb/utils"
+	"strconv"
+	"sync"
+)
+
+const (
+	defaultObjectTag = "host"
+
+	defaultFirstCounterID = 10000
+
+	defaultFirstObjectID = 1000000
+)
+
+// IngestConfig is config/ingest.json. Ingestion is disabled without the file, and
+// a listener without an address isn't started.
+type IngestConfig struct {
+	InfluxAddress string `json:"influxAddress"` // TCP and UDP address of the line protocol listener
+
+	GraphiteAddress string `json:"graphiteAddress"` // TCP and UDP address of the plaintext listener
+
+	Precision string `json:"precision"` // of line protocol timestamps, ns (default), us, ms or s
+
+	ObjectTag string `json:"objectTag"` // line protocol tag naming the object, host by default
+
+	ObjectNode int `json:"objectNode"` // node of Graphite paths naming the object, the others name the counter
+
+	AutoRegister bool `json:"autoRegister"` // give unknown names the next free IDs instead of dropping them
+
+	FirstCounterID uint16 `json:"firstCounterID"` // first ID given to registered counters, 10000 by default
+
+	FirstObjectID uint32 `json:"firstObjectID"` // first ID given to registered objects, 1000000 by default
+
+	Counters map[string]uint16 `json:"counters"` // counter names, besides the names in counter.json
+
+	Objects map[string]uint32 `json:"objects"` // object names, numeric names are IDs themselves
+}
+
+// sample is one parsed value, named the way the protocol names it. Values are
+// uint64, float64 or string.
+type sample struct {
+	counter string
+
+	object string
+
+	timestamp uint32
+
+	value interface{}
+}
+
+// Mapping resolves counter and object names to IDs. Names registered
+// automatically are saved to ./database/ingest_names.json.
+type Mapping struct {
+	config IngestConfig
+
+	registered registeredNames
+
+	lock sync.Mutex
+
+	path string
+}
+
+type registeredNames struct {
+	Counters map[string]registeredCounter `json:"counters"`
+
+	Objects map[string]uint32 `json:"objects"`
+}
+
+type registeredCounter struct {
+	ID uint16 `json:"id"`
+
+	Type DataType `json:"type"`
+}
+
+func newMapping(config IngestConfig, baseDir string) *Mapping {
+
+	if config.ObjectTag == "" {
+
+		config.ObjectTag = defaultObjectTag
+	}
+
+	if config.FirstCounterID == 0 {
+
+		config.FirstCounterID = defaultFirstCounterID
+	}
+
+	if config.FirstObjectID == 0 {
+
+		config.FirstObjectID = defaultFirstObjectID
+	}
+
+	return &Mapping{
+
+		config: config,
+
+		registered: registeredNames{
+
+			Counters: make(map[string]registeredCounter),
+
+			Objects: make(map[string]uint32),
+		},
+
+		path: baseDir + "/database/ingest_names.json",
+	}
+}
+
+// load reads the registered names and registers their counter types.
+func (mapping *Mapping) load() error {
+
+	data, err := os.ReadFile(mapping.path)
+
+	if os.IsNotExist(err) {
+
+		return nil
+	}
+
+	if err != nil {
+
+		return fmt.Errorf("error reading registered names: %v", err)
+	}
+
+	if err := json.Unmarshal(data, &mapping.registered); err != nil {
+
+		return fmt.Errorf("error parsing registered names: %v", err)
+	}
+
+	for name, counter := range mapping.registered.Counters {
+
+		if err := RegisterCounterType(counter.ID, counter.Type); err != nil {
+
+			return fmt.Errorf("error registering counter %q: %v", name, err)
+		}
+	}
+
+	return nil
+}
+
+// resolve turns a sample into an event, registering unknown names when
+// allowed. Values are converted to the type of the counter.
+func (mapping *Mapping) resolve(sample sample) (Events, error) {
+
+	mapping.lock.Lock()
+
+	defer mapping.lock.Unlock()
+
+	counterID, err := mapping.getCounterID(sample.counter, sample.value)
+
+	if err != nil {
+
+		return Events{}, err
+	}
+
+	objectID, err := mapping.getObjectID(sample.object)
+
+	if err != nil {
+
+		return Events{}, err
+	}
+
+	dataType, err := GetCounterType(counterID)
+
+	if err != nil {
+
+		return Events{}, err
+	}
+
+	value, err := convertValue(sample.value, dataType)
+
+	if err != nil {
+
+		return Events{}, fmt.Errorf("counter %q: %v", sample.counter, err)
+	}
+
+	return Events{ObjectId: objectID, CounterId: counterID, Timestamp: sample.timestamp, Value: value}, nil
+}
+
+func (mapping *Mapping) getCounterID(name string, value interface{}) (uint16, error) {
+
+	if counterID, ok := mapping.config.Counters[name]; ok {
+
+		return counterID, nil
+	}
+
+	if counterID, ok := GetCounterID(name); ok {
+
+		return counterID, nil
+	}
+
+	if counter, ok := mapping.registered.Counters[name]; ok {
+
+		return counter.ID, nil
+	}
+
+	if !mapping.config.AutoRegister {
+
+		return 0, fmt.Errorf("unknown counter %q", name)
+	}
+
+	dataType := TypeFloat64
+
+	switch value.(type) {
+
+	case uint64:
+
+		dataType = TypeUint64
+
+	case string:
+
+		dataType = TypeString
+	}
+
+	for counterID := mapping.config.FirstCounterID; counterID != 0; counterID++ { // 0 once the IDs wrap around
+
+		if _, err := GetCounterType(counterID); err == nil {
+
+			continue
+		}
+
+		if err := RegisterCounterType(counterID, dataType); err != nil {
+
+			return 0, err
+		}
+
+		mapping.registered.Counters[name] = registeredCounter{ID: counterID, Type: dataType}
+
+		return counterID, mapping.save()
+	}
+
+	return 0, fmt.Errorf("no counter ID left for %q", name)
+}
+
+func (mapping *Mapping) getObjectID(name string) (uint32, error) {
+
+	if objectID, ok := mapping.config.Objects[name]; ok {
+
+		return objectID, nil
+	}
+
+	if objectID, err := strconv.ParseUint(name, 10, 32); err == nil {
+
+		return uint32(objectID), nil
+	}
+
+	if objectID, ok := mapping.registered.Objects[name]; ok {
+
+		return objectID, nil
+	}
+
+	if !mapping.config.AutoRegister {
+
+		return 0, fmt.Errorf("unknown object %q", name)
+	}
+
+	objectID := mapping.config.FirstObjectID
+
+	for _, registered := range mapping.registered.Objects {
+
+		objectID = max(objectID, registered+1)
+	}
+
+	mapping.registered.Objects[name] = objectID
+
+	return objectID, mapping.save()
+}
+
+// save writes the registered names. The caller holds mapping.lock.
+func (mapping *Mapping) save() error {
+
+	data, err := json.MarshalIndent(mapping.registered, "", "  ")
+
+	if err == nil {
+
+		err = os.MkdirAll(filepath.Dir(mapping.path), 0755)
+	}
+
+	if err == nil {
+
+		err = os.WriteFile(mapping.path+".tmp", data, 0644)
+	}
+
+	if err == nil {
+
+		err = os.Rename(mapping.path+".tmp", mapping.path)
+	}
+
+	if err != nil {
+
+		return fmt.Errorf("error saving registered names: %v", err)
+	}
+
+	return nil
+}
+
+func convertValue(value interface{}, dataType DataType) (interface{}, error) {
+
+	switch dataType {
+
+	case TypeUint64:
+
+		switch number := value.(type) {
+
+		case uint64:
+
+			return number, nil
+
+		case float64:
+
+			if number >= 0 && number < math.MaxUint64 && number == math.Trunc(number) {
+
+				return uint64(number), nil
+			}
+		}
+
+		return nil, fmt.Errorf("takes unsigned integers, got %v", value)
+
+	case TypeFloat64:
+
+		switch number := value.(type) {
+
+		case uint64:
+
+			return float64(number), nil
+
+		case float64:
+
+			return number, nil
+		}
+
+		return nil, fmt.Errorf("takes numbers, got %q", value)
+	}
+
+	if text, ok := value.(string); ok {
+
+		return text, nil
+	}
+
+	return nil, fmt.Errorf("takes strings, got %v", value)
+}
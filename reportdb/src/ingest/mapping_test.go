@@ -0,0 +1,57 @@
+package ingest
+
+import (
+	. "reportdb/utils"
+	"testing"
+)
+
+func TestConvertValue(t *testing.T) {
+
+	tests := []struct {
+		value interface{}
+
+		dataType DataType
+
+		want interface{}
+	}{
+		{uint64(5), TypeUint64, uint64(5)},
+
+		{5.0, TypeUint64, uint64(5)},
+
+		{5.5, TypeUint64, nil},
+
+		{-1.0, TypeUint64, nil},
+
+		{"5", TypeUint64, nil},
+
+		{uint64(5), TypeFloat64, 5.0},
+
+		{-2.5, TypeFloat64, -2.5},
+
+		{"up", TypeFloat64, nil},
+
+		{"up", TypeString, "up"},
+
+		{1.0, TypeString, nil},
+	}
+
+	for _, test := range tests {
+
+		got, err := convertValue(test.value, test.dataType)
+
+		if test.want == nil {
+
+			if err == nil {
+
+				t.Errorf("convertValue(%v, %d) = %v, want an error", test.value, test.dataType, got)
+			}
+
+			continue
+		}
+
+		if err != nil || got != test.want {
+
+			t.Errorf("convertValue(%v, %d) = %v, %v, want %v", test.value, test.dataType, got, err, test.want)
+		}
+	}
+}
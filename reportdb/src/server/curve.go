@@ -0,0 +1,115 @@
+package server
+
+import (
+	"fmt"
+	"github.com/pebbe/zmq4"
+	"go.uber.org/zap"
+	. "reportdb/logger"
+	. "reportdb/utils"
+)
+
+const (
+	zapEndpoint = "inproc://zeromq.zap.01"
+
+	curveDomain = "reportdb"
+)
+
+// startAuthenticator answers the ZAP requests of the CURVE sockets of
+// context, admitting the authorized client keys. zmq4.AuthStart only serves
+// the default context, so every server runs its own. The handler closes once
+// context is terminated.
+func startAuthenticator(context *zmq4.Context) error {
+
+	curve := GetCurve()
+
+	if curve.SecretKey == "" {
+
+		return nil
+	}
+
+	if len(curve.AuthorizedKeys) == 0 {
+
+		return fmt.Errorf("curve.authorizedKeys is empty, no client could connect")
+	}
+
+	authorized := make(map[string]bool, len(curve.AuthorizedKeys))
+
+	for _, key := range curve.AuthorizedKeys {
+
+		authorized[key] = true
+	}
+
+	handler, err := context.NewSocket(zmq4.REP)
+
+	if err != nil {
+
+		return fmt.Errorf("failed to create ZAP socket: %v", err)
+	}
+
+	handler.SetLinger(0)
+
+	if err := handler.Bind(zapEndpoint); err != nil {
+
+		handler.Close()
+
+		return fmt.Errorf("failed to bind ZAP socket: %v", err)
+	}
+
+	go func() {
+
+		for {
+
+			request, err := handler.RecvMessageBytes(0)
+
+			if err != nil {
+
+				if zmq4.AsErrno(err) == zmq4.ETERM {
+
+					handler.Close()
+
+					return
+				}
+
+				continue
+			}
+
+			// version, request ID, domain, address, identity, mechanism, client key
+			if len(request) < 7 {
+
+				handler.SendMessage("1.0", "", "500", "invalid request", "", "")
+
+				continue
+			}
+
+			clientKey := zmq4.Z85encode(string(request[6]))
+
+			if !authorized[clientKey] && !authorized["*"] {
+
+				Logger.Warn("Authenticator: client key rejected", zap.String("address", string(request[3])), zap.String("key", clientKey))
+
+				handler.SendMessage(request[0], request[1], "400", "unauthorized key", "", "")
+
+				continue
+			}
+
+			handler.SendMessage(request[0], request[1], "200", "OK", clientKey, "")
+		}
+	}()
+
+	return nil
+}
+
+// bindSocket binds socket to endpoint, as a CURVE server when a secret key is
+// configured.
+func bindSocket(socket *zmq4.Socket, endpoint string) error {
+
+	if curve := GetCurve(); curve.SecretKey != "" {
+
+		if err := socket.ServerAuthCurve(curveDomain, curve.SecretKey); err != nil {
+
+			return fmt.Errorf("failed to set CURVE keys: %v", err)
+		}
+	}
+
+	return socket.Bind(endpoint)
+}
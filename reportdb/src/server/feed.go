@@ -0,0 +1,154 @@
+package server
+
+import (
+	"fmt"
+	"github.com/pebbe/zmq4"
+	"github.com/vmihailenco/msgpack/v5"
+	"go.uber.org/zap"
+	. "reportdb/datastore/feed"
+	. "reportdb/logger"
+	. "reportdb/utils"
+	"strconv"
+	"time"
+)
+
+const feedReportInterval = 10 * time.Second
+
+// FeedServer publishes every stored event on a PUB socket, one message of
+// [topic, event] per event, where the topic is "counterID/objectID/". SUB
+// sockets filter by prefix, "2/" for counter 2 or "2/1001/" for object 1001
+// of it. An object can't be selected across counters, subscribers take one
+// prefix per counter instead.
+type FeedServer struct {
+	pubSocket *zmq4.Socket
+
+	context *zmq4.Context
+
+	feed *Feed
+
+	subscription *Subscription
+
+	done chan bool
+}
+
+func NewFeedServer(feed *Feed) (*FeedServer, error) {
+
+	context, err := zmq4.NewContext()
+
+	if err != nil {
+
+		return nil, fmt.Errorf("failed to create context: %v", err)
+	}
+
+	if err := startAuthenticator(context); err != nil {
+
+		context.Term()
+
+		return nil, err
+	}
+
+	pubSocket, err := context.NewSocket(zmq4.PUB)
+
+	if err != nil {
+
+		context.Term()
+
+		return nil, fmt.Errorf("failed to create PUB socket: %v", err)
+	}
+
+	pubSocket.SetLinger(0)
+
+	pubSocket.SetSndhwm(GetFeedBuffer()) // slow subscribers lose messages past it, the socket never blocks
+
+	if err := bindSocket(pubSocket, GetFeedEndpoint()); err != nil {
+
+		pubSocket.Close()
+
+		context.Term()
+
+		return nil, fmt.Errorf("failed to bind PUB socket: %v", err)
+	}
+
+	server := &FeedServer{
+
+		pubSocket: pubSocket,
+
+		context: context,
+
+		feed: feed,
+
+		subscription: feed.Subscribe(GetFeedBuffer()),
+
+		done: make(chan bool, 1),
+	}
+
+	go server.eventPublisher()
+
+	return server, nil
+}
+
+func (server *FeedServer) eventPublisher() {
+
+	ticker := time.NewTicker(feedReportInterval)
+
+	defer func() {
+
+		ticker.Stop()
+
+		server.pubSocket.Close()
+
+		server.done <- true
+	}()
+
+	reported := uint64(0)
+
+	for {
+
+		select {
+
+		case event, ok := <-server.subscription.Events:
+
+			if !ok {
+
+				return
+			}
+
+			payload, err := msgpack.Marshal(event)
+
+			if err != nil {
+
+				Logger.Warn("eventPublisher : Error marshalling event", zap.Error(err))
+
+				continue
+			}
+
+			topic := strconv.Itoa(int(event.CounterId)) + "/" + strconv.Itoa(int(event.ObjectId)) + "/"
+
+			if _, err := server.pubSocket.SendMessage(topic, payload); err != nil {
+
+				Logger.Warn("eventPublisher : Error publishing event", zap.Error(err))
+			}
+
+		case <-ticker.C:
+
+			if dropped := server.subscription.Dropped(); dropped > reported {
+
+				Logger.Warn("FeedServer: events dropped, the publisher can't keep up",
+					zap.Uint64("dropped", dropped-reported),
+					zap.Uint64("total_dropped", dropped),
+				)
+
+				reported = dropped
+			}
+		}
+	}
+}
+
+func (server *FeedServer) Shutdown() {
+
+	server.feed.Unsubscribe(server.subscription)
+
+	<-server.done
+
+	server.context.Term()
+}
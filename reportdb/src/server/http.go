@@ -0,0 +1,301 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"net"
+	"net/http"
+	. "reportdb/logger"
+	. "reportdb/utils"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	maxRequestBytes = 32 << 20
+
+	firstHTTPRequestID = 1 << 62 // keeps HTTP request IDs apart from the backend's and continuous queries'
+
+	httpShutdownTimeout = 10 * time.Second
+)
+
+// HTTPServer exposes ingest, queries and admin commands over HTTP next to
+// the ZMQ sockets, for scripts and debugging. It feeds the same channels.
+type HTTPServer struct {
+	server *http.Server
+
+	dataChannel chan []Events
+
+	queryChannel chan QueryReceive
+
+	adminHandler func(AdminCommand) (interface{}, error)
+
+	requestID atomic.Uint64
+}
+
+// NewHTTPServer listens on address, returning a nil server when address is
+// empty.
+func NewHTTPServer(address string, dataChannel chan []Events, queryChannel chan QueryReceive, adminHandler func(AdminCommand) (interface{}, error)) (*HTTPServer, error) {
+
+	if address == "" {
+
+		return nil, nil
+	}
+
+	server := &HTTPServer{
+
+		dataChannel: dataChannel,
+
+		queryChannel: queryChannel,
+
+		adminHandler: adminHandler,
+	}
+
+	server.requestID.Store(firstHTTPRequestID)
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("POST /write", server.handleWrite)
+
+	mux.HandleFunc("POST /query", server.handleQuery)
+
+	mux.HandleFunc("POST /admin", server.handleAdmin)
+
+	mux.HandleFunc("GET /health", func(writer http.ResponseWriter, _ *http.Request) {
+
+		writeJSON(writer, http.StatusOK, map[string]string{"status": "ok"})
+	})
+
+	server.server = &http.Server{
+
+		Addr: address,
+
+		Handler: mux,
+
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	listener, err := net.Listen("tcp", address) // fails here rather than in the background
+
+	if err != nil {
+
+		return nil, fmt.Errorf("failed to listen on %s: %v", address, err)
+	}
+
+	go func() {
+
+		if err := server.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+
+			Logger.Error("HTTPServer: serve failed", zap.Error(err))
+		}
+	}()
+
+	return server, nil
+}
+
+// handleWrite accepts a JSON array of Events. Values are converted to the
+// type of their counter, since JSON has no unsigned integers.
+func (server *HTTPServer) handleWrite(writer http.ResponseWriter, request *http.Request) {
+
+	decoder := json.NewDecoder(http.MaxBytesReader(writer, request.Body, maxRequestBytes))
+
+	decoder.UseNumber()
+
+	var events []Events
+
+	if err := decoder.Decode(&events); err != nil {
+
+		writeError(writer, http.StatusBadRequest, ErrInvalidQuery, fmt.Sprintf("invalid events: %v", err))
+
+		return
+	}
+
+	for i := range events {
+
+		if err := convertEventValue(&events[i]); err != nil {
+
+			writeError(writer, http.StatusBadRequest, ErrInvalidQuery, fmt.Sprintf("event %d: %v", i, err))
+
+			return
+		}
+	}
+
+	if len(events) > 0 {
+
+		server.dataChannel <- events
+	}
+
+	writeJSON(writer, http.StatusAccepted, map[string]int{"accepted": len(events)})
+}
+
+// handleQuery runs a Query and returns its Response.
+func (server *HTTPServer) handleQuery(writer http.ResponseWriter, request *http.Request) {
+
+	var query Query
+
+	if err := json.NewDecoder(http.MaxBytesReader(writer, request.Body, maxRequestBytes)).Decode(&query); err != nil {
+
+		writeError(writer, http.StatusBadRequest, ErrInvalidQuery, fmt.Sprintf("invalid query: %v", err))
+
+		return
+	}
+
+	replies := make(chan []byte, 1)
+
+	server.queryChannel <- QueryReceive{
+
+		RequestID: server.requestID.Add(1),
+
+		Query: query,
+
+		Reply: func(response Response) {
+
+			encoded, err := json.Marshal(response) // before the reader reuses its buffers
+
+			if err != nil {
+
+				encoded, _ = json.Marshal(Response{RequestID: response.RequestID, Error: err.Error(), Code: ErrInternal})
+			}
+
+			replies <- encoded
+		},
+	}
+
+	select {
+
+	case encoded := <-replies:
+
+		writer.Header().Set("Content-Type", "application/json")
+
+		writer.WriteHeader(http.StatusOK)
+
+		writer.Write(encoded)
+
+	case <-request.Context().Done():
+	}
+}
+
+// handleAdmin runs an AdminCommand, the way admin requests on the query
+// socket are.
+func (server *HTTPServer) handleAdmin(writer http.ResponseWriter, request *http.Request) {
+
+	var command AdminCommand
+
+	if err := json.NewDecoder(http.MaxBytesReader(writer, request.Body, maxRequestBytes)).Decode(&command); err != nil {
+
+		writeError(writer, http.StatusBadRequest, ErrInvalidQuery, fmt.Sprintf("invalid admin command: %v", err))
+
+		return
+	}
+
+	response := Response{
+
+		RequestID: server.requestID.Add(1),
+	}
+
+	data, err := server.adminHandler(command)
+
+	if err != nil {
+
+		Logger.Warn("HTTPServer : Admin command failed", zap.String("action", command.Action), zap.Error(err))
+
+		response.Error = err.Error()
+
+		response.Code = GetErrorCode(err)
+
+	} else {
+
+		response.Data = data
+	}
+
+	writeJSON(writer, http.StatusOK, response)
+}
+
+// Shutdown stops accepting requests and waits for the running ones. It must
+// run before the channels the server feeds are closed.
+func (server *HTTPServer) Shutdown() {
+
+	if server == nil {
+
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), httpShutdownTimeout)
+
+	defer cancel()
+
+	if err := server.server.Shutdown(ctx); err != nil {
+
+		Logger.Warn("HTTPServer: shutdown failed", zap.Error(err))
+	}
+}
+
+func convertEventValue(event *Events) error {
+
+	dataType, err := GetCounterType(event.CounterId)
+
+	if err != nil {
+
+		return err
+	}
+
+	text := fmt.Sprint(event.Value)
+
+	switch value := event.Value.(type) {
+
+	case json.Number:
+
+		switch dataType {
+
+		case TypeUint64:
+
+			event.Value, err = strconv.ParseUint(text, 10, 64)
+
+		case TypeFloat64:
+
+			event.Value, err = value.Float64()
+
+		default:
+
+			err = fmt.Errorf("counter %d takes strings, got %s", event.CounterId, text)
+		}
+
+	case string:
+
+		if dataType != TypeString {
+
+			err = fmt.Errorf("counter %d takes numbers, got %q", event.CounterId, value)
+
+		} else if len(value) > MaxStringLength {
+
+			err = fmt.Errorf("counter %d takes strings of up to %d bytes, got %d", event.CounterId, MaxStringLength, len(value))
+		}
+
+	default:
+
+		err = fmt.Errorf("invalid value %v for counter %d", event.Value, event.CounterId)
+	}
+
+	return err
+}
+
+func writeJSON(writer http.ResponseWriter, status int, value interface{}) {
+
+	writer.Header().Set("Content-Type", "application/json")
+
+	writer.WriteHeader(status)
+
+	if err := json.NewEncoder(writer).Encode(value); err != nil {
+
+		Logger.Warn("HTTPServer : Error encoding response", zap.Error(err))
+	}
+}
+
+func writeError(writer http.ResponseWriter, status int, code string, message string) {
+
+	writeJSON(writer, status, Response{Error: message, Code: code})
+}
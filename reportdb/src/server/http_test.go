@@ -0,0 +1,53 @@
+package server
+
+import (
+	"encoding/json"
+	. "reportdb/utils"
+	"strings"
+	"testing"
+)
+
+func TestConvertEventValue(t *testing.T) {
+
+	if err := RegisterCounterType(901, TypeString); err != nil {
+
+		t.Fatal(err)
+	}
+
+	if err := RegisterCounterType(902, TypeUint64); err != nil {
+
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+
+		counterID uint16
+
+		value interface{}
+
+		ok bool
+	}{
+		{"string", 901, "up", true},
+
+		{"longest string", 901, strings.Repeat("a", MaxStringLength), true},
+
+		{"string too long", 901, strings.Repeat("a", MaxStringLength+1), false},
+
+		{"number for a string counter", 901, json.Number("1"), false},
+
+		{"number", 902, json.Number("42"), true},
+
+		{"string for a number counter", 902, "up", false},
+	}
+
+	for _, test := range tests {
+
+		event := Events{CounterId: test.counterID, Value: test.value}
+
+		if err := convertEventValue(&event); (err == nil) != test.ok {
+
+			t.Errorf("%s: convertEventValue error = %v, want ok %v", test.name, err, test.ok)
+		}
+	}
+}
@@ -7,17 +7,75 @@ import (
 	"go.uber.org/zap"
 	. "reportdb/logger"
 	. "reportdb/utils"
+	"sync"
+	"syscall"
+	"time"
 )
 
+const (
+	ackInterval = 50 * time.Millisecond // longest an ack waits for the socket
+
+	ackBuffer = 10000
+
+	maxBatchIDs = 100000 // batch IDs remembered to drop retransmitted batches
+)
+
+// PollingServer receives event batches on a ROUTER socket. A batch sent as
+// [batch ID, events] is acknowledged with [batch ID] once stored, and a batch
+// whose ID was stored before is only acknowledged again. Events rejected for
+// good are logged and don't hold the ack back, and when the store fails an
+// event only the failed events of the retransmission are stored. One sent as
+// [events] is stored without acknowledgement.
 type PollingServer struct {
-	pullSocket *zmq4.Socket
+	routerSocket *zmq4.Socket
 
 	context *zmq4.Context
 
 	shutdownPull chan bool
+
+	acks chan batchAck
+
+	batchIDs *batchIDs
+}
+
+type batchAck struct {
+	identity string
+
+	batchID string
+}
+
+type batchState uint8
+
+const (
+	batchNew batchState = iota // never received, or forgotten
+
+	batchPending // handed to the writers
+
+	batchDone // stored, or dropped for good when it can't be decoded
+
+	batchFailed // the store failed some events, a retransmission stores them
+)
+
+type batchRecord struct {
+	state batchState
+
+	failed []int // indexes of the events a retransmission of a failed batch stores
 }
 
-func NewPollingServer(dataChannel chan []Events) (*PollingServer, error) {
+// batchIDs remembers the state of the last maxBatchIDs batches. States are
+// set by the writers, so that a stored batch is acknowledged again when its
+// retransmission arrives, even if its first acknowledgement was dropped.
+type batchIDs struct {
+	states map[string]batchRecord
+
+	order []string
+
+	next int
+
+	lock sync.Mutex
+}
+
+func NewPollingServer(dataChannel chan []Events, batchChannel chan Batch) (*PollingServer, error) {
 
 	context, err := zmq4.NewContext()
 
@@ -26,39 +84,52 @@ func NewPollingServer(dataChannel chan []Events) (*PollingServer, error) {
 		return nil, fmt.Errorf("failed to create context: %v", err)
 	}
 
-	pullSocket, err := context.NewSocket(zmq4.PULL)
+	if err := startAuthenticator(context); err != nil {
+
+		context.Term()
+
+		return nil, err
+	}
+
+	routerSocket, err := context.NewSocket(zmq4.ROUTER)
 
 	if err != nil {
 
 		context.Term()
 
-		return nil, fmt.Errorf("failed to create PULL socket: %v", err)
+		return nil, fmt.Errorf("failed to create ROUTER socket: %v", err)
 	}
 
-	if err := pullSocket.Bind("tcp://*:6003"); err != nil {
+	routerSocket.SetRcvtimeo(ackInterval) // acks are sent between receives
+
+	if err := bindSocket(routerSocket, GetPollingEndpoint()); err != nil {
 
-		pullSocket.Close()
+		routerSocket.Close()
 
 		context.Term()
 
-		return nil, fmt.Errorf("failed to bind PULL socket: %v", err)
+		return nil, fmt.Errorf("failed to bind ROUTER socket: %v", err)
 	}
 
 	server := &PollingServer{
 
-		pullSocket: pullSocket,
+		routerSocket: routerSocket,
 
 		context: context,
 
 		shutdownPull: make(chan bool, 1),
+
+		acks: make(chan batchAck, ackBuffer),
+
+		batchIDs: newBatchIDs(),
 	}
 
-	go server.pollingReceiver(dataChannel)
+	go server.pollingReceiver(dataChannel, batchChannel)
 
 	return server, nil
 }
 
-func (server *PollingServer) pollingReceiver(dataChannel chan []Events) {
+func (server *PollingServer) pollingReceiver(dataChannel chan []Events, batchChannel chan Batch) {
 
 	for {
 
@@ -66,7 +137,7 @@ func (server *PollingServer) pollingReceiver(dataChannel chan []Events) {
 
 		case <-server.shutdownPull:
 
-			server.pullSocket.Close()
+			server.routerSocket.Close()
 
 			server.shutdownPull <- true
 
@@ -74,22 +145,65 @@ func (server *PollingServer) pollingReceiver(dataChannel chan []Events) {
 
 		default:
 
-			batchData, err := server.pullSocket.RecvBytes(0)
+			server.sendAcks()
+
+			frames, err := server.routerSocket.RecvMessageBytes(0)
 
 			if err != nil {
 
-				Logger.Warn("pollingReceiver : Error receiving batchData", zap.Error(err))
+				if zmq4.AsErrno(err) != zmq4.Errno(syscall.EAGAIN) {
+
+					Logger.Warn("pollingReceiver : Error receiving batchData", zap.Error(err))
+				}
+
+				continue
+			}
+
+			if len(frames) < 2 || len(frames) > 3 {
+
+				Logger.Warn("pollingReceiver : Invalid message", zap.Int("frames", len(frames)))
 
 				continue
 			}
 
+			identity, batchID, batchData := string(frames[0]), "", frames[len(frames)-1]
+
+			var retry []int // events left to store of a failed batch, nil for all
+
+			if len(frames) == 3 {
+
+				batchID = string(frames[1])
+
+				var state batchState
+
+				switch state, retry = server.batchIDs.receive(batchID); state {
+
+				case batchPending: // the ack follows once it is stored
+
+					continue
+
+				case batchDone: // the ack was lost or dropped
+
+					server.routerSocket.SendMessage(identity, batchID)
+
+					continue
+				}
+			}
+
 			var events []Events
 
 			err = msgpack.Unmarshal(batchData, &events)
 
 			if err != nil {
 
-				Logger.Warn("pollingReceiver : Error unmarshalling batchData", zap.Error(err))
+				Logger.Error("pollingReceiver : Dropping a batch that can't be unmarshalled", zap.String("batch_id", batchID), zap.Error(err))
+
+				if batchID != "" { // acknowledged, it would fail again
+
+					server.batchIDs.set(batchID, batchDone)
+
+					server.routerSocket.SendMessage(identity, batchID)
+				}
 
 				continue
 			}
@@ -98,9 +212,176 @@ func (server *PollingServer) pollingReceiver(dataChannel chan []Events) {
 				zap.Int("count", len(events)),
 			)
 
-			dataChannel <- events
+			if batchID == "" {
+
+				dataChannel <- events
+
+				continue
+			}
+
+			events, indexes := retryEvents(events, retry)
+
+			batchChannel <- Batch{
+
+				Events: events,
+
+				Stored: func() {
+
+					server.batchIDs.set(batchID, batchDone)
+
+					select {
+
+					case server.acks <- batchAck{identity: identity, batchID: batchID}:
+
+					default: // the sender retransmits the batch and gets the ack then
+					}
+				},
+
+				Failed: func(failed []int) {
+
+					for i, index := range failed {
+
+						failed[i] = indexes[index]
+					}
+
+					server.batchIDs.fail(batchID, failed)
+
+					Logger.Warn("PollingServer: events of the batch not stored, waiting for its retransmission",
+						zap.String("batch_id", batchID),
+						zap.Int("failed", len(failed)),
+					)
+				},
+			}
+		}
+	}
+}
+
+func (server *PollingServer) sendAcks() {
+
+	for {
+
+		select {
+
+		case ack := <-server.acks:
+
+			if _, err := server.routerSocket.SendMessage(ack.identity, ack.batchID); err != nil {
+
+				Logger.Warn("pollingReceiver : Error sending ack", zap.String("batch_id", ack.batchID), zap.Error(err))
+			}
+
+		default:
+
+			return
+		}
+	}
+}
+
+// retryEvents returns the events of a batch at the indexes of retry, all of
+// them when retry is nil, and the index in the batch of each one returned.
+func retryEvents(events []Events, retry []int) ([]Events, []int) {
+
+	if retry == nil {
+
+		indexes := make([]int, len(events))
+
+		for i := range indexes {
+
+			indexes[i] = i
+		}
+
+		return events, indexes
+	}
+
+	kept := make([]Events, 0, len(retry))
+
+	indexes := make([]int, 0, len(retry))
+
+	for _, index := range retry {
+
+		if index < len(events) { // the sender changed the batch, which it shouldn't
+
+			kept = append(kept, events[index])
+
+			indexes = append(indexes, index)
+		}
+	}
+
+	return kept, indexes
+}
+
+func newBatchIDs() *batchIDs {
+
+	return &batchIDs{
+
+		states: make(map[string]batchRecord),
+
+		order: make([]string, 0, maxBatchIDs),
+	}
+}
+
+// receive returns the state of batchID before it arrived again, with the
+// events left to store when it failed, and marks it pending when its events
+// are to be stored, new or failed before. The oldest ID is forgotten when
+// maxBatchIDs are remembered.
+func (batchIDs *batchIDs) receive(batchID string) (batchState, []int) {
+
+	batchIDs.lock.Lock()
+
+	defer batchIDs.lock.Unlock()
+
+	record, seen := batchIDs.states[batchID]
+
+	if record.state == batchPending || record.state == batchDone {
+
+		return record.state, nil
+	}
+
+	if !seen {
+
+		if len(batchIDs.order) < maxBatchIDs {
+
+			batchIDs.order = append(batchIDs.order, batchID)
+
+		} else {
+
+			delete(batchIDs.states, batchIDs.order[batchIDs.next])
+
+			batchIDs.order[batchIDs.next] = batchID
+
+			batchIDs.next = (batchIDs.next + 1) % maxBatchIDs
 		}
 	}
+
+	batchIDs.states[batchID] = batchRecord{state: batchPending}
+
+	return record.state, record.failed
+}
+
+// set records the outcome of a batch, unless its ID was forgotten meanwhile.
+func (batchIDs *batchIDs) set(batchID string, state batchState) {
+
+	batchIDs.lock.Lock()
+
+	defer batchIDs.lock.Unlock()
+
+	if _, seen := batchIDs.states[batchID]; seen {
+
+		batchIDs.states[batchID] = batchRecord{state: state}
+	}
+}
+
+// fail records the events of a batch the store failed, by their index in
+// the batch as sent, unless its ID was forgotten meanwhile.
+func (batchIDs *batchIDs) fail(batchID string, failed []int) {
+
+	batchIDs.lock.Lock()
+
+	defer batchIDs.lock.Unlock()
+
+	if _, seen := batchIDs.states[batchID]; seen {
+
+		batchIDs.states[batchID] = batchRecord{state: batchFailed, failed: failed}
+	}
 }
 
 func (server *PollingServer) Shutdown() {
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"reflect"
+	. "reportdb/utils"
+	"strconv"
+	"testing"
+)
+
+func TestBatchIDs(t *testing.T) {
+
+	batchIDs := newBatchIDs()
+
+	steps := []struct {
+		name string
+
+		set batchState // outcome reported by the writers before the batch arrives, if any
+
+		failed []int // events the store failed when set is batchFailed
+
+		want batchState
+
+		retry []int
+	}{
+		{name: "first delivery is stored", want: batchNew},
+
+		{name: "retransmission while writing is dropped", want: batchPending},
+
+		{name: "retransmission after a failure stores the failed events", set: batchFailed, failed: []int{1, 3}, want: batchFailed, retry: []int{1, 3}},
+
+		{name: "retransmission after storing is acknowledged again", set: batchDone, want: batchDone},
+
+		{name: "and again", want: batchDone},
+	}
+
+	for _, step := range steps {
+
+		switch step.set {
+
+		case batchFailed:
+
+			batchIDs.fail("a", step.failed)
+
+		case batchNew:
+
+		default:
+
+			batchIDs.set("a", step.set)
+		}
+
+		if got, retry := batchIDs.receive("a"); got != step.want || !reflect.DeepEqual(retry, step.retry) {
+
+			t.Errorf("%s: receive = %d %v, want %d %v", step.name, got, retry, step.want, step.retry)
+		}
+	}
+
+	batchIDs.set("unknown", batchDone) // its ID was forgotten
+
+	if got, _ := batchIDs.receive("unknown"); got != batchNew {
+
+		t.Errorf("batch stored after being forgotten: receive = %d, want %d", got, batchNew)
+	}
+}
+
+func TestBatchIDsForgetTheOldest(t *testing.T) {
+
+	batchIDs := newBatchIDs()
+
+	for i := 0; i <= maxBatchIDs; i++ {
+
+		batchIDs.receive(strconv.Itoa(i))
+
+		batchIDs.set(strconv.Itoa(i), batchDone)
+	}
+
+	if got, _ := batchIDs.receive("0"); got != batchNew {
+
+		t.Errorf("oldest batch: receive = %d, want %d", got, batchNew)
+	}
+
+	if got, _ := batchIDs.receive(strconv.Itoa(maxBatchIDs)); got != batchDone {
+
+		t.Errorf("newest batch: receive = %d, want %d", got, batchDone)
+	}
+
+	if len(batchIDs.states) != maxBatchIDs {
+
+		t.Errorf("%d batch IDs remembered, want %d", len(batchIDs.states), maxBatchIDs)
+	}
+}
+
+func TestRetryEvents(t *testing.T) {
+
+	events := []Events{{ObjectId: 0}, {ObjectId: 1}, {ObjectId: 2}, {ObjectId: 3}}
+
+	tests := []struct {
+		name string
+
+		retry []int
+
+		objects []uint32
+
+		indexes []int
+	}{
+		{"whole batch", nil, []uint32{0, 1, 2, 3}, []int{0, 1, 2, 3}},
+
+		{"failed events", []int{1, 3}, []uint32{1, 3}, []int{1, 3}},
+
+		{"index past a changed batch", []int{2, 7}, []uint32{2}, []int{2}},
+	}
+
+	for _, test := range tests {
+
+		kept, indexes := retryEvents(events, test.retry)
+
+		objects := make([]uint32, 0, len(kept))
+
+		for _, event := range kept {
+
+			objects = append(objects, event.ObjectId)
+		}
+
+		if !reflect.DeepEqual(objects, test.objects) || !reflect.DeepEqual(indexes, test.indexes) {
+
+			t.Errorf("%s: retryEvents = %v %v, want %v %v", test.name, objects, indexes, test.objects, test.indexes)
+		}
+	}
+}
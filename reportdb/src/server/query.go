@@ -20,9 +20,13 @@ type QueryServer struct {
 	shutdownPull chan bool
 
 	shutdownPush chan bool
+
+	adminHandler func(AdminCommand) (interface{}, error)
 }
 
-func NewQueryServer(queryChannel chan QueryReceive, resultChannel chan Response) (*QueryServer, error) {
+// NewQueryServer starts the query sockets. Requests carrying an AdminCommand
+// are answered by adminHandler instead of the readers.
+func NewQueryServer(queryChannel chan QueryReceive, resultChannel chan Response, adminHandler func(AdminCommand) (interface{}, error)) (*QueryServer, error) {
 
 	context, err := zmq4.NewContext()
 
@@ -31,6 +35,13 @@ func NewQueryServer(queryChannel chan QueryReceive, resultChannel chan Response)
 		return nil, fmt.Errorf("failed to create context: %v", err)
 	}
 
+	if err := startAuthenticator(context); err != nil {
+
+		context.Term()
+
+		return nil, err
+	}
+
 	pullSocket, err := context.NewSocket(zmq4.PULL)
 
 	if err != nil {
@@ -40,7 +51,7 @@ func NewQueryServer(queryChannel chan QueryReceive, resultChannel chan Response)
 		return nil, fmt.Errorf("failed to create PULL socket: %v", err)
 	}
 
-	if err := pullSocket.Bind("tcp://*:6004"); err != nil {
+	if err := bindSocket(pullSocket, GetQueryEndpoint()); err != nil {
 
 		pullSocket.Close()
 
@@ -62,7 +73,7 @@ func NewQueryServer(queryChannel chan QueryReceive, resultChannel chan Response)
 
 	pushSocket.SetLinger(0)
 
-	if err := pushSocket.Bind("tcp://*:6005"); err != nil {
+	if err := bindSocket(pushSocket, GetResultEndpoint()); err != nil {
 
 		pushSocket.Close()
 
@@ -84,16 +95,18 @@ func NewQueryServer(queryChannel chan QueryReceive, resultChannel chan Response)
 		shutdownPull: make(chan bool, 1),
 
 		shutdownPush: make(chan bool, 1),
+
+		adminHandler: adminHandler,
 	}
 
-	go server.queryReceiver(queryChannel)
+	go server.queryReceiver(queryChannel, resultChannel)
 
 	go server.responseSender(resultChannel)
 
 	return server, nil
 }
 
-func (queryServer *QueryServer) queryReceiver(queryChannel chan QueryReceive) {
+func (queryServer *QueryServer) queryReceiver(queryChannel chan QueryReceive, resultChannel chan Response) {
 
 	for {
 
@@ -129,11 +142,43 @@ func (queryServer *QueryServer) queryReceiver(queryChannel chan QueryReceive) {
 				return
 			}
 
+			if query.Admin != nil {
+
+				resultChannel <- queryServer.handleAdmin(query)
+
+				continue
+			}
+
 			queryChannel <- query
 		}
 	}
 }
 
+func (queryServer *QueryServer) handleAdmin(query QueryReceive) Response {
+
+	response := Response{
+
+		RequestID: query.RequestID,
+	}
+
+	data, err := queryServer.adminHandler(*query.Admin)
+
+	if err != nil {
+
+		Logger.Warn("queryReceiver : Admin command failed", zap.String("action", query.Admin.Action), zap.Error(err))
+
+		response.Error = err.Error()
+
+		response.Code = GetErrorCode(err)
+
+		return response
+	}
+
+	response.Data = data
+
+	return response
+}
+
 func (queryServer *QueryServer) responseSender(resultChannel chan Response) {
 
 	for {
@@ -0,0 +1,219 @@
+package storage
+
+import (
+	"fmt"
+	"github.com/vmihailenco/msgpack/v5"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+)
+
+// LatestValues holds the most recent sample of every object of every counter,
+// updated by the writers, so the last known state is read without scanning a
+// day. It is saved next to the object registry.
+type LatestValues struct {
+	counters map[uint16]map[uint32]*atomic.Pointer[LatestSample] // counters[counterID][objectID]
+
+	lock *sync.RWMutex
+
+	path string // ./database/latest.msg
+
+	dirty atomic.Bool
+}
+
+type LatestSample struct {
+	Timestamp uint32 `msgpack:"timestamp" json:"timestamp"`
+
+	Value interface{} `msgpack:"value" json:"value"`
+}
+
+func NewLatestValues(baseDir string) *LatestValues {
+
+	return &LatestValues{
+
+		counters: make(map[uint16]map[uint32]*atomic.Pointer[LatestSample]),
+
+		lock: &sync.RWMutex{},
+
+		path: baseDir + "/database/latest.msg",
+	}
+}
+
+// Load reads the saved table. Without one the table starts empty and fills
+// as samples are written.
+func (latest *LatestValues) Load() error {
+
+	data, err := os.ReadFile(latest.path)
+
+	if os.IsNotExist(err) {
+
+		return nil
+	}
+
+	if err != nil {
+
+		return fmt.Errorf("error reading latest values file: %v", err)
+	}
+
+	saved := make(map[uint16]map[uint32]LatestSample)
+
+	if err := msgpack.Unmarshal(data, &saved); err != nil {
+
+		return fmt.Errorf("error parsing latest values file: %v", err)
+	}
+
+	latest.lock.Lock()
+
+	defer latest.lock.Unlock()
+
+	for counterID, objects := range saved {
+
+		latest.counters[counterID] = make(map[uint32]*atomic.Pointer[LatestSample], len(objects))
+
+		for objectID, sample := range objects {
+
+			latest.counters[counterID][objectID] = newLatestPointer(sample)
+		}
+	}
+
+	return nil
+}
+
+// Update records a sample of objectID of counterID, unless a later one is
+// already known.
+func (latest *LatestValues) Update(counterID uint16, objectID uint32, timestamp uint32, value interface{}) {
+
+	sample := &LatestSample{Timestamp: timestamp, Value: value}
+
+	latest.lock.RLock()
+
+	pointer, exists := latest.counters[counterID][objectID]
+
+	latest.lock.RUnlock()
+
+	if !exists {
+
+		latest.lock.Lock()
+
+		if latest.counters[counterID] == nil {
+
+			latest.counters[counterID] = make(map[uint32]*atomic.Pointer[LatestSample])
+		}
+
+		if pointer, exists = latest.counters[counterID][objectID]; !exists {
+
+			latest.counters[counterID][objectID] = newLatestPointer(*sample)
+
+			latest.dirty.Store(true)
+
+			latest.lock.Unlock()
+
+			return
+		}
+
+		latest.lock.Unlock()
+	}
+
+	for current := pointer.Load(); timestamp >= current.Timestamp; current = pointer.Load() {
+
+		if pointer.CompareAndSwap(current, sample) {
+
+			latest.dirty.Store(true)
+
+			break
+		}
+	}
+}
+
+// Get returns the latest sample of every object of counterID, or of the
+// given objects when there are any.
+func (latest *LatestValues) Get(counterID uint16, objectIDs []uint32) map[uint32]LatestSample {
+
+	latest.lock.RLock()
+
+	defer latest.lock.RUnlock()
+
+	objects := latest.counters[counterID]
+
+	samples := make(map[uint32]LatestSample, max(len(objectIDs), len(objects)))
+
+	if len(objectIDs) == 0 {
+
+		for objectID, pointer := range objects {
+
+			samples[objectID] = *pointer.Load()
+		}
+
+		return samples
+	}
+
+	for _, objectID := range objectIDs {
+
+		if pointer, exists := objects[objectID]; exists {
+
+			samples[objectID] = *pointer.Load()
+		}
+	}
+
+	return samples
+}
+
+func (latest *LatestValues) Save() error {
+
+	if !latest.dirty.Swap(false) {
+
+		return nil
+	}
+
+	saved := make(map[uint16]map[uint32]LatestSample)
+
+	latest.lock.RLock()
+
+	for counterID, objects := range latest.counters {
+
+		saved[counterID] = make(map[uint32]LatestSample, len(objects))
+
+		for objectID, pointer := range objects {
+
+			saved[counterID][objectID] = *pointer.Load()
+		}
+	}
+
+	latest.lock.RUnlock()
+
+	data, err := msgpack.Marshal(saved)
+
+	if err == nil {
+
+		err = os.MkdirAll(filepath.Dir(latest.path), 0755)
+	}
+
+	if err == nil {
+
+		err = os.WriteFile(latest.path+".tmp", data, 0644)
+	}
+
+	if err == nil {
+
+		err = os.Rename(latest.path+".tmp", latest.path) // never leave a truncated table behind
+	}
+
+	if err != nil {
+
+		latest.dirty.Store(true)
+
+		return fmt.Errorf("error saving latest values: %v", err)
+	}
+
+	return nil
+}
+
+func newLatestPointer(sample LatestSample) *atomic.Pointer[LatestSample] {
+
+	pointer := &atomic.Pointer[LatestSample]{}
+
+	pointer.Store(&sample)
+
+	return pointer
+}
@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestLatestValues(t *testing.T) {
+
+	latest := NewLatestValues(t.TempDir())
+
+	latest.Update(1, 10, 100, 1.5)
+
+	latest.Update(1, 10, 90, 0.5) // older, ignored
+
+	latest.Update(1, 20, 100, 2.5)
+
+	latest.Update(1, 20, 100, 3.5) // same second, the last write wins
+
+	latest.Update(2, 10, 50, "up")
+
+	want := map[uint32]LatestSample{10: {Timestamp: 100, Value: 1.5}, 20: {Timestamp: 100, Value: 3.5}}
+
+	if got := latest.Get(1, nil); !reflect.DeepEqual(got, want) {
+
+		t.Errorf("Get(1) = %v, want %v", got, want)
+	}
+
+	want = map[uint32]LatestSample{20: {Timestamp: 100, Value: 3.5}}
+
+	if got := latest.Get(1, []uint32{20, 30}); !reflect.DeepEqual(got, want) {
+
+		t.Errorf("Get(1, [20 30]) = %v, want %v", got, want)
+	}
+
+	if got := latest.Get(3, nil); len(got) != 0 {
+
+		t.Errorf("Get of an unknown counter = %v, want no samples", got)
+	}
+}
+
+func TestLatestValuesConcurrentUpdates(t *testing.T) {
+
+	latest := NewLatestValues(t.TempDir())
+
+	var waitGroup sync.WaitGroup
+
+	for writer := 0; writer < 8; writer++ {
+
+		waitGroup.Add(1)
+
+		go func(writer int) {
+
+			defer waitGroup.Done()
+
+			for timestamp := uint32(writer); timestamp < 8000; timestamp += 8 {
+
+				latest.Update(1, 10, timestamp, float64(timestamp))
+			}
+		}(writer)
+	}
+
+	waitGroup.Wait()
+
+	if got := latest.Get(1, nil)[10]; got.Timestamp != 7999 || got.Value != 7999.0 {
+
+		t.Errorf("latest sample = %+v, want the one at 7999", got)
+	}
+}
+
+func TestLatestValuesSaveLoad(t *testing.T) {
+
+	baseDir := t.TempDir()
+
+	latest := NewLatestValues(baseDir)
+
+	latest.Update(1, 10, 100, 1.5)
+
+	latest.Update(2, 10, 50, "up")
+
+	if err := latest.Save(); err != nil {
+
+		t.Fatal(err)
+	}
+
+	loaded := NewLatestValues(baseDir)
+
+	if err := loaded.Load(); err != nil {
+
+		t.Fatal(err)
+	}
+
+	for counterID := uint16(1); counterID <= 2; counterID++ {
+
+		if got, want := loaded.Get(counterID, nil), latest.Get(counterID, nil); !reflect.DeepEqual(got, want) {
+
+			t.Errorf("loaded counter %d = %v, want %v", counterID, got, want)
+		}
+	}
+
+	if err := NewLatestValues(t.TempDir()).Load(); err != nil {
+
+		t.Errorf("Load without a file: %v", err)
+	}
+}
@@ -0,0 +1,474 @@
+package storage
+
+import (
+	"fmt"
+	"github.com/vmihailenco/msgpack/v5"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	. "reportdb/logger"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ObjectRegistry records, for every counter, which objects have data and the
+// first and last timestamp seen for each of them. Readers use it to resolve
+// queries without object IDs and to skip days an object has no data for.
+type ObjectRegistry struct {
+	counters map[uint16]map[uint32]*objectSpan // counters[counterID][objectID]
+
+	lock *sync.RWMutex
+
+	path string // ./database/registry.msg
+
+	dirty atomic.Bool
+}
+
+type objectSpan struct {
+	firstSeen atomic.Uint32
+
+	lastSeen atomic.Uint32
+
+	lastDay atomic.Uint32 // last marked day + 1, repeated writes skip the lock
+
+	lock sync.Mutex
+
+	firstDay uint32 // day of the first bit of days, a multiple of 64
+
+	days []uint64 // bit i is set when the object has data on day firstDay+i
+}
+
+type savedSpan struct {
+	FirstSeen uint32 `msgpack:"firstSeen"`
+
+	LastSeen uint32 `msgpack:"lastSeen"`
+
+	FirstDay uint32 `msgpack:"firstDay"`
+
+	Days []uint64 `msgpack:"days,omitempty"`
+}
+
+// Days are counted from the epoch in UTC, the days the day directories hold.
+const secondsPerDay = 24 * 60 * 60
+
+func NewObjectRegistry(baseDir string) *ObjectRegistry {
+
+	return &ObjectRegistry{
+
+		counters: make(map[uint16]map[uint32]*objectSpan),
+
+		lock: &sync.RWMutex{},
+
+		path: baseDir + "/database/registry.msg",
+	}
+}
+
+// Load reads the registry file, then merges the indexes saved after it, which
+// a crash may have left unregistered. Without a file the registry is rebuilt
+// from every day directory.
+func (registry *ObjectRegistry) Load() error {
+
+	info, err := os.Stat(registry.path)
+
+	if os.IsNotExist(err) {
+
+		return registry.merge(time.Time{})
+	}
+
+	if err != nil {
+
+		return fmt.Errorf("error reading registry file: %v", err)
+	}
+
+	data, err := os.ReadFile(registry.path)
+
+	if err != nil {
+
+		return fmt.Errorf("error reading registry file: %v", err)
+	}
+
+	saved := make(map[uint16]map[uint32]savedSpan)
+
+	if err := msgpack.Unmarshal(data, &saved); err != nil {
+
+		return fmt.Errorf("error parsing registry file: %v", err)
+	}
+
+	registry.lock.Lock()
+
+	for counterID, objects := range saved {
+
+		registry.counters[counterID] = make(map[uint32]*objectSpan, len(objects))
+
+		for objectID, saved := range objects {
+
+			span := newObjectSpan(saved.FirstSeen, saved.LastSeen)
+
+			if saved.Days == nil { // saved before days were recorded
+
+				for day := saved.FirstSeen / secondsPerDay; day <= saved.LastSeen/secondsPerDay; day++ {
+
+					span.markDay(day)
+				}
+
+			} else {
+
+				span.firstDay, span.days = saved.FirstDay, saved.Days
+			}
+
+			registry.counters[counterID][objectID] = span
+		}
+	}
+
+	registry.lock.Unlock()
+
+	return registry.merge(info.ModTime())
+}
+
+// merge registers every object found in the indexes of the day directories
+// saved at or after since. Only the day of the data is known, so spans are
+// widened by a day on each side to stay safe whatever the local zone was.
+func (registry *ObjectRegistry) merge(since time.Time) error {
+
+	databaseDir := filepath.Dir(registry.path)
+
+	paths, err := filepath.Glob(databaseDir + "/*/*/*/counter_*")
+
+	if err != nil {
+
+		return fmt.Errorf("error listing day directories: %v", err)
+	}
+
+	merged := 0
+
+	for _, path := range paths {
+
+		relative, _ := filepath.Rel(databaseDir, path) // YYYY/MM/DD/counter_N
+
+		day, err := time.Parse("2006/01/02", filepath.Dir(relative))
+
+		if err != nil {
+
+			continue
+		}
+
+		counterID, err := strconv.ParseUint(strings.TrimPrefix(filepath.Base(path), "counter_"), 10, 16)
+
+		if err != nil {
+
+			continue
+		}
+
+		if !since.IsZero() && !savedSince(path, since) {
+
+			continue
+		}
+
+		merged++
+
+		engine := NewStorageEngine(path)
+
+		objects, err := engine.GetKeys()
+
+		engine.indexManager.Close()
+
+		if err != nil {
+
+			return fmt.Errorf("error reading keys of %s: %v", path, err)
+		}
+
+		for _, objectID := range objects {
+
+			// the day before is skipped for the epoch, whose timestamp can't go lower
+			if day.Unix() >= secondsPerDay {
+
+				registry.Touch(uint16(counterID), objectID, uint32(day.Add(-24*time.Hour).Unix()))
+			}
+
+			registry.Touch(uint16(counterID), objectID, uint32(day.Unix()))
+
+			registry.Touch(uint16(counterID), objectID, uint32(day.Add(48*time.Hour).Unix()-1))
+		}
+	}
+
+	if merged == 0 {
+
+		return nil
+	}
+
+	Logger.Info("Object registry merged from day indexes", zap.Int("days", merged))
+
+	return registry.Save()
+}
+
+// savedSince reports whether an index of the day directory at path was saved
+// at or after since.
+func savedSince(path string, since time.Time) bool {
+
+	indexes, _ := filepath.Glob(path + "/index_*.msg")
+
+	for _, index := range indexes {
+
+		if info, err := os.Stat(index); err == nil && !info.ModTime().Before(since) {
+
+			return true
+		}
+	}
+
+	return false
+}
+
+// Touch records that objectID of counterID has data at timestamp.
+func (registry *ObjectRegistry) Touch(counterID uint16, objectID uint32, timestamp uint32) {
+
+	registry.lock.RLock()
+
+	span, exists := registry.counters[counterID][objectID]
+
+	registry.lock.RUnlock()
+
+	if !exists {
+
+		registry.lock.Lock()
+
+		if registry.counters[counterID] == nil {
+
+			registry.counters[counterID] = make(map[uint32]*objectSpan)
+		}
+
+		if span, exists = registry.counters[counterID][objectID]; !exists {
+
+			span = newObjectSpan(timestamp, timestamp)
+
+			span.markDay(timestamp / secondsPerDay)
+
+			registry.counters[counterID][objectID] = span
+
+			registry.dirty.Store(true)
+
+			registry.lock.Unlock()
+
+			return
+		}
+
+		registry.lock.Unlock()
+	}
+
+	for first := span.firstSeen.Load(); timestamp < first; first = span.firstSeen.Load() {
+
+		if span.firstSeen.CompareAndSwap(first, timestamp) {
+
+			registry.dirty.Store(true)
+
+			break
+		}
+	}
+
+	for last := span.lastSeen.Load(); timestamp > last; last = span.lastSeen.Load() {
+
+		if span.lastSeen.CompareAndSwap(last, timestamp) {
+
+			registry.dirty.Store(true)
+
+			break
+		}
+	}
+
+	if span.markDay(timestamp / secondsPerDay) {
+
+		registry.dirty.Store(true)
+	}
+}
+
+// GetObjects returns the objects of counterID with data within [from, to].
+func (registry *ObjectRegistry) GetObjects(counterID uint16, from uint32, to uint32) []uint32 {
+
+	registry.lock.RLock()
+
+	defer registry.lock.RUnlock()
+
+	var objects []uint32
+
+	for objectID, span := range registry.counters[counterID] {
+
+		if span.hasData(from, to) {
+
+			objects = append(objects, objectID)
+		}
+	}
+
+	sort.Slice(objects, func(i, j int) bool {
+
+		return objects[i] < objects[j]
+	})
+
+	return objects
+}
+
+// HasData reports whether objectID of counterID may have data within [from, to].
+// Objects the registry doesn't know may have data anywhere.
+func (registry *ObjectRegistry) HasData(counterID uint16, objectID uint32, from uint32, to uint32) bool {
+
+	registry.lock.RLock()
+
+	span, exists := registry.counters[counterID][objectID]
+
+	registry.lock.RUnlock()
+
+	return !exists || span.hasData(from, to)
+}
+
+func (registry *ObjectRegistry) Save() error {
+
+	if !registry.dirty.Swap(false) {
+
+		return nil
+	}
+
+	saved := make(map[uint16]map[uint32]savedSpan)
+
+	registry.lock.RLock()
+
+	for counterID, objects := range registry.counters {
+
+		saved[counterID] = make(map[uint32]savedSpan, len(objects))
+
+		for objectID, span := range objects {
+
+			span.lock.Lock()
+
+			saved[counterID][objectID] = savedSpan{
+
+				FirstSeen: span.firstSeen.Load(),
+
+				LastSeen: span.lastSeen.Load(),
+
+				FirstDay: span.firstDay,
+
+				Days: append([]uint64(nil), span.days...),
+			}
+
+			span.lock.Unlock()
+		}
+	}
+
+	registry.lock.RUnlock()
+
+	data, err := msgpack.Marshal(saved)
+
+	if err == nil {
+
+		err = os.MkdirAll(filepath.Dir(registry.path), 0755)
+	}
+
+	if err == nil {
+
+		err = os.WriteFile(registry.path+".tmp", data, 0644)
+	}
+
+	if err == nil {
+
+		err = os.Rename(registry.path+".tmp", registry.path) // never leave a truncated registry behind
+	}
+
+	if err != nil {
+
+		registry.dirty.Store(true)
+
+		return fmt.Errorf("error saving registry: %v", err)
+	}
+
+	return nil
+}
+
+func newObjectSpan(firstSeen uint32, lastSeen uint32) *objectSpan {
+
+	span := &objectSpan{}
+
+	span.firstSeen.Store(firstSeen)
+
+	span.lastSeen.Store(lastSeen)
+
+	return span
+}
+
+// markDay records that the object has data on day, reporting whether it was
+// new.
+func (span *objectSpan) markDay(day uint32) bool {
+
+	if span.lastDay.Load() == day+1 {
+
+		return false
+	}
+
+	span.lock.Lock()
+
+	defer span.lock.Unlock()
+
+	if len(span.days) == 0 {
+
+		span.firstDay = day - day%64
+
+	} else if day < span.firstDay {
+
+		firstDay := day - day%64
+
+		span.days = append(make([]uint64, (span.firstDay-firstDay)/64), span.days...)
+
+		span.firstDay = firstDay
+	}
+
+	bit := day - span.firstDay
+
+	for int(bit/64) >= len(span.days) {
+
+		span.days = append(span.days, 0)
+	}
+
+	mask := uint64(1) << (bit % 64)
+
+	marked := span.days[bit/64]&mask == 0
+
+	span.days[bit/64] |= mask
+
+	span.lastDay.Store(day + 1)
+
+	return marked
+}
+
+// hasData reports whether the object may have data within [from, to], which
+// needs the span to overlap it and data on one of its days.
+func (span *objectSpan) hasData(from uint32, to uint32) bool {
+
+	if span.firstSeen.Load() > to || span.lastSeen.Load() < from {
+
+		return false
+	}
+
+	span.lock.Lock()
+
+	defer span.lock.Unlock()
+
+	if len(span.days) == 0 {
+
+		return false
+	}
+
+	lastDay := span.firstDay + uint32(len(span.days))*64 - 1
+
+	for day := max(from/secondsPerDay, span.firstDay); day <= min(to/secondsPerDay, lastDay); day++ {
+
+		bit := day - span.firstDay
+
+		if span.days[bit/64]&(uint64(1)<<(bit%64)) != 0 {
+
+			return true
+		}
+	}
+
+	return false
+}
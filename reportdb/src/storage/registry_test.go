@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const day = 24 * 60 * 60
+
+func TestObjectRegistry(t *testing.T) {
+
+	registry := NewObjectRegistry(t.TempDir())
+
+	registry.Touch(1, 10, 3*day+100)
+
+	registry.Touch(1, 10, 5*day+100) // no data on day 4
+
+	registry.Touch(1, 10, 200*day) // past the first bitset word
+
+	registry.Touch(1, 20, 4*day)
+
+	registry.Touch(2, 10, 4*day)
+
+	tests := []struct {
+		name string
+
+		objectID uint32
+
+		from, to uint32
+
+		want bool
+	}{
+		{"first day", 10, 3 * day, 3*day + day - 1, true},
+
+		{"gap day", 10, 4 * day, 4*day + day - 1, false},
+
+		{"range over the gap", 10, 4 * day, 5 * day, true},
+
+		{"before the first point", 10, 3 * day, 3*day + 99, false},
+
+		{"far day", 10, 200 * day, 200*day + 10, true},
+
+		{"after the last point", 10, 200*day + 1, 201 * day, false},
+
+		{"unknown object", 30, 0, 1000 * day, true},
+	}
+
+	for _, test := range tests {
+
+		if got := registry.HasData(1, test.objectID, test.from, test.to); got != test.want {
+
+			t.Errorf("%s: HasData = %v, want %v", test.name, got, test.want)
+		}
+	}
+
+	if got := registry.GetObjects(1, 4*day, 4*day+day-1); !reflect.DeepEqual(got, []uint32{20}) {
+
+		t.Errorf("GetObjects of the gap day = %v, want [20]", got)
+	}
+
+	if got := registry.GetObjects(1, 0, 300*day); !reflect.DeepEqual(got, []uint32{10, 20}) {
+
+		t.Errorf("GetObjects = %v, want [10 20]", got)
+	}
+}
+
+func TestObjectRegistryEarlierDays(t *testing.T) {
+
+	registry := NewObjectRegistry(t.TempDir())
+
+	registry.Touch(1, 10, 300*day)
+
+	registry.Touch(1, 10, 2*day) // prepends bitset words
+
+	for _, current := range []uint32{2, 300} {
+
+		if !registry.HasData(1, 10, current*day, current*day+day-1) {
+
+			t.Errorf("day %d is missing", current)
+		}
+	}
+
+	if registry.HasData(1, 10, 3*day, 299*day+day-1) {
+
+		t.Error("days between the two points have data")
+	}
+}
+
+func TestObjectRegistrySaveLoad(t *testing.T) {
+
+	baseDir := t.TempDir()
+
+	registry := NewObjectRegistry(baseDir)
+
+	registry.Touch(1, 10, 3*day)
+
+	registry.Touch(1, 10, 5*day)
+
+	if err := registry.Save(); err != nil {
+
+		t.Fatal(err)
+	}
+
+	loaded := NewObjectRegistry(baseDir)
+
+	if err := loaded.Load(); err != nil {
+
+		t.Fatal(err)
+	}
+
+	if !loaded.HasData(1, 10, 5*day, 5*day+10) || loaded.HasData(1, 10, 4*day, 4*day+day-1) {
+
+		t.Error("loaded registry lost the days of object 10")
+	}
+
+	if got := loaded.GetObjects(1, 0, 10*day); !reflect.DeepEqual(got, []uint32{10}) {
+
+		t.Errorf("GetObjects = %v, want [10]", got)
+	}
+}
+
+func TestSavedSince(t *testing.T) {
+
+	path := t.TempDir()
+
+	registrySaved := time.Now()
+
+	if savedSince(path, registrySaved) {
+
+		t.Error("directory without indexes was saved")
+	}
+
+	index := path + "/index_0.msg"
+
+	if err := os.WriteFile(index, nil, 0644); err != nil {
+
+		t.Fatal(err)
+	}
+
+	if err := os.Chtimes(index, registrySaved.Add(-time.Hour), registrySaved.Add(-time.Hour)); err != nil {
+
+		t.Fatal(err)
+	}
+
+	if savedSince(path, registrySaved) {
+
+		t.Error("index saved before the registry was merged")
+	}
+
+	if err := os.Chtimes(index, registrySaved.Add(time.Second), registrySaved.Add(time.Second)); err != nil {
+
+		t.Fatal(err)
+	}
+
+	if !savedSince(path, registrySaved) {
+
+		t.Error("index saved after the registry was not merged")
+	}
+}
@@ -15,6 +15,10 @@ type StorePool struct {
 
 	lock *sync.RWMutex
 
+	registry *ObjectRegistry
+
+	latest *LatestValues
+
 	shutdown chan bool
 }
 
@@ -26,10 +30,34 @@ func NewStorePool() *StorePool {
 
 		lock: &sync.RWMutex{},
 
+		registry: NewObjectRegistry(GetWorkingDirectory()),
+
+		latest: NewLatestValues(GetWorkingDirectory()),
+
 		shutdown: make(chan bool, 1),
 	}
 }
 
+func (storePool *StorePool) LoadRegistry() error {
+
+	return storePool.registry.Load()
+}
+
+func (storePool *StorePool) GetRegistry() *ObjectRegistry {
+
+	return storePool.registry
+}
+
+func (storePool *StorePool) LoadLatest() error {
+
+	return storePool.latest.Load()
+}
+
+func (storePool *StorePool) GetLatest() *LatestValues {
+
+	return storePool.latest
+}
+
 func (storePool *StorePool) GetEngine(path string, isForPut bool) (*StoreEngine, error) {
 
 	// Reading From storePool
@@ -131,6 +159,16 @@ func (storePool *StorePool) flushAllEngines() {
 			//engine.isUsedPut = false
 		}
 	}
+
+	if err := storePool.registry.Save(); err != nil {
+
+		Logger.Error("Failed to save object registry", zap.Error(err))
+	}
+
+	if err := storePool.latest.Save(); err != nil {
+
+		Logger.Error("Failed to save latest values", zap.Error(err))
+	}
 }
 
 func (storePool *StorePool) Shutdown() {
@@ -159,18 +197,14 @@ func (storePool *StorePool) Shutdown() {
 	}
 
 	storePool.lock.Unlock()
-}
 
-func (storePool *StorePool) CheckEngineUsedPut(day string) bool {
-
-	storePool.lock.RLock()
+	if err := storePool.registry.Save(); err != nil {
 
-	defer storePool.lock.RUnlock()
+		Logger.Error("Failed to save object registry", zap.Error(err))
+	}
 
-	if engine, exists := storePool.storePool[day]; exists && engine.isUsedPut == true {
+	if err := storePool.latest.Save(); err != nil {
 
-		return true
+		Logger.Error("Failed to save latest values", zap.Error(err))
 	}
-
-	return false
 }
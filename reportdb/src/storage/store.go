@@ -1,11 +1,16 @@
 package storage
 
 import (
+	"context"
 	"encoding/binary"
 	"fmt"
 	. "reportdb/utils"
+	"sync/atomic"
+	"time"
 )
 
+const cancelCheckInterval = 1024 // records scanned between checks of the query context
+
 type StoreEngine struct {
 	fileManager *FileManager
 
@@ -76,34 +81,70 @@ func (store *StoreEngine) Put(key uint32, data []byte) error {
 	return nil
 }
 
-func (store *StoreEngine) Get(key uint32, from uint32, to uint32) ([][]byte, error) {
+// Get returns the records of key within [from, to]. The scan stops early with
+// the context error once ctx is cancelled. Index and scan work is added to stats.
+func (store *StoreEngine) Get(ctx context.Context, key uint32, from uint32, to uint32, stats *QueryStats) ([][]byte, error) {
 
-	fileId, err := getPartitionId(key)
+	var dayResult [][]byte
+
+	err := store.Scan(ctx, key, from, to, stats, func(record []byte) {
+
+		dayResult = append(dayResult, record)
+	})
 
 	if err != nil {
 
 		return nil, err
 	}
 
+	return dayResult, nil
+}
+
+// Scan calls visit with every record of key within [from, to], its timestamp
+// followed by its value, without collecting them. It stops like Get.
+func (store *StoreEngine) Scan(ctx context.Context, key uint32, from uint32, to uint32, stats *QueryStats, visit func(record []byte)) error {
+
+	fileId, err := getPartitionId(key)
+
+	if err != nil {
+
+		return err
+	}
+
+	indexStarted := time.Now()
+
 	entryList, err := store.indexManager.GetIndexMapEntryList(key, fileId, store.isUsedPut)
 
+	atomic.AddInt64(&stats.IndexLoadTime, time.Since(indexStarted).Nanoseconds())
+
 	if err != nil {
 
-		return nil, fmt.Errorf("store.indexManager.GetIndexMapEntryList error: %v", err)
+		return fmt.Errorf("store.indexManager.GetIndexMapEntryList error: %v", err)
 	}
 
 	handle, err := store.fileManager.GetHandle(fileId)
 
 	if err != nil {
 
-		return nil, fmt.Errorf("failed to get handle for partition %d: %v", fileId, err)
+		return fmt.Errorf("failed to get handle for partition %d: %v", fileId, err)
 	}
 
 	handle.lock.RLock()
 
 	defer handle.lock.RUnlock()
 
-	var dayResult [][]byte
+	scanStarted := time.Now()
+
+	scanned := 0
+
+	defer func() {
+
+		atomic.AddInt64(&stats.IndexEntries, int64(len(entryList)))
+
+		atomic.AddInt64(&stats.RecordsScanned, int64(scanned))
+
+		atomic.AddInt64(&stats.ScanTime, time.Since(scanStarted).Nanoseconds())
+	}()
 
 	for _, entry := range entryList {
 
@@ -111,23 +152,32 @@ func (store *StoreEngine) Get(key uint32, from uint32, to uint32) ([][]byte, err
 
 		end := entry.EntryEnd
 
+		atomic.AddInt64(&stats.BytesScanned, end-start)
+
 		for start < end {
 
+			if scanned++; scanned%cancelCheckInterval == 0 {
+
+				if err := ctx.Err(); err != nil {
+
+					return err
+				}
+			}
+
 			length := binary.LittleEndian.Uint32(handle.mappedBuffer[start : start+4])
 
 			timestamp := binary.LittleEndian.Uint32(handle.mappedBuffer[start+4 : start+8])
 
 			if timestamp >= from && timestamp <= to {
 
-				dayResult = append(dayResult, handle.mappedBuffer[start+4:start+8+int64(length)])
+				visit(handle.mappedBuffer[start+4 : start+8+int64(length)])
 			}
 
 			start = start + 8 + int64(length)
 		}
 	}
 
-	return dayResult, nil
-
+	return nil
 }
 
 func (store *StoreEngine) GetKeys() ([]uint32, error) {
@@ -135,6 +185,14 @@ func (store *StoreEngine) GetKeys() ([]uint32, error) {
 	return store.indexManager.GetAllKeys()
 }
 
+// Close releases an engine that isn't managed by a StorePool.
+func (store *StoreEngine) Close() {
+
+	store.fileManager.Close()
+
+	store.indexManager.Close()
+}
+
 func getPartitionId(key uint32) (uint8, error) {
 
 	partitions := uint8(GetPartitions())
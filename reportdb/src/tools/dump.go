@@ -0,0 +1,251 @@
+package tools
+
+import (
+	"compress/gzip"
+	"context"
+	"flag"
+	"fmt"
+	"github.com/vmihailenco/msgpack/v5"
+	"math"
+	"os"
+	"path/filepath"
+	. "reportdb/datastore/reader"
+	. "reportdb/storage"
+	. "reportdb/utils"
+	"strconv"
+	"time"
+)
+
+const (
+	dumpVersion = 1
+
+	dumpBatchSize = 10000
+)
+
+// dumpHeader starts a dump file. It is followed by msgpack encoded []Events
+// batches until the end of the gzip stream.
+type dumpHeader struct {
+	Version int `msgpack:"version"`
+
+	CounterID uint16 `msgpack:"counterId"`
+
+	Type DataType `msgpack:"type"`
+}
+
+// Dump exports the day directories of one counter to a portable file:
+//
+//	reportdb dump -counter 1 [-from 2025-05-01] [-to 2025-05-31] -out counter_1.dump
+//
+// It reads the index files, which a running instance only saves every
+// saveIndexInterval seconds, so it must run against a stopped instance.
+func Dump(args []string) error {
+
+	flags := flag.NewFlagSet("dump", flag.ContinueOnError)
+
+	counterID := flags.Uint("counter", 0, "counter ID to export")
+
+	from := flags.String("from", "", "first day to export, YYYY-MM-DD")
+
+	to := flags.String("to", "", "last day to export, YYYY-MM-DD")
+
+	out := flags.String("out", "", "file to write")
+
+	if err := flags.Parse(args); err != nil {
+
+		return err
+	}
+
+	if *counterID == 0 || *counterID > math.MaxUint16 || *out == "" {
+
+		return fmt.Errorf("dump needs -counter and -out")
+	}
+
+	dataType, err := GetCounterType(uint16(*counterID))
+
+	if err != nil {
+
+		return err
+	}
+
+	paths, err := getDayPaths(uint16(*counterID), *from, *to)
+
+	if err != nil {
+
+		return err
+	}
+
+	file, err := os.Create(*out)
+
+	if err != nil {
+
+		return fmt.Errorf("error creating %s: %v", *out, err)
+	}
+
+	defer file.Close()
+
+	compressor := gzip.NewWriter(file)
+
+	encoder := msgpack.NewEncoder(compressor)
+
+	header := dumpHeader{
+
+		Version: dumpVersion,
+
+		CounterID: uint16(*counterID),
+
+		Type: dataType,
+	}
+
+	if err := encoder.Encode(header); err != nil {
+
+		return fmt.Errorf("error writing header: %v", err)
+	}
+
+	total := 0
+
+	for _, path := range paths {
+
+		count, err := dumpDay(encoder, path, header)
+
+		if err != nil {
+
+			return fmt.Errorf("error dumping %s: %v", path, err)
+		}
+
+		total += count
+	}
+
+	if err := compressor.Close(); err != nil {
+
+		return fmt.Errorf("error writing %s: %v", *out, err)
+	}
+
+	fmt.Printf("dumped %d events of counter %d from %d days to %s\n", total, *counterID, len(paths), *out)
+
+	return nil
+}
+
+func dumpDay(encoder *msgpack.Encoder, path string, header dumpHeader) (int, error) {
+
+	engine := NewStorageEngine(path)
+
+	defer engine.Close()
+
+	objects, err := engine.GetKeys()
+
+	if err != nil {
+
+		return 0, err
+	}
+
+	batch := make([]Events, 0, dumpBatchSize)
+
+	total := 0
+
+	for _, objectID := range objects {
+
+		records, err := engine.Get(context.Background(), objectID, 0, math.MaxUint32, &QueryStats{})
+
+		if err != nil {
+
+			return total, err
+		}
+
+		var points []DataPoint
+
+		DecodeData(records, header.Type, &points)
+
+		for _, point := range points {
+
+			batch = append(batch, Events{
+
+				ObjectId: objectID,
+
+				CounterId: header.CounterID,
+
+				Timestamp: point.Timestamp,
+
+				Value: point.Value,
+			})
+
+			if len(batch) == dumpBatchSize {
+
+				if err := encoder.Encode(batch); err != nil {
+
+					return total, err
+				}
+
+				total += len(batch)
+
+				batch = batch[:0]
+			}
+		}
+	}
+
+	if len(batch) > 0 {
+
+		if err := encoder.Encode(batch); err != nil {
+
+			return total, err
+		}
+
+		total += len(batch)
+	}
+
+	return total, nil
+}
+
+// getDayPaths lists the day directories of a counter, oldest first, limited
+// to [from, to] when given.
+func getDayPaths(counterID uint16, from string, to string) ([]string, error) {
+
+	databaseDir := GetWorkingDirectory() + "/database"
+
+	paths, err := filepath.Glob(databaseDir + "/*/*/*/counter_" + strconv.Itoa(int(counterID)))
+
+	if err != nil {
+
+		return nil, err
+	}
+
+	var fromDay, toDay string
+
+	for _, bound := range []struct {
+		value string
+
+		day *string
+	}{{from, &fromDay}, {to, &toDay}} {
+
+		if bound.value == "" {
+
+			continue
+		}
+
+		day, err := time.Parse("2006-01-02", bound.value)
+
+		if err != nil {
+
+			return nil, fmt.Errorf("invalid day %q, expected YYYY-MM-DD", bound.value)
+		}
+
+		*bound.day = day.Format("2006/01/02")
+	}
+
+	var selected []string
+
+	for _, path := range paths { // Glob returns them sorted, so by day
+
+		relative, _ := filepath.Rel(databaseDir, path)
+
+		day := filepath.Dir(relative)
+
+		if (fromDay != "" && day < fromDay) || (toDay != "" && day > toDay) {
+
+			continue
+		}
+
+		selected = append(selected, path)
+	}
+
+	return selected, nil
+}
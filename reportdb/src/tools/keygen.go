@@ -0,0 +1,45 @@
+package tools
+
+import (
+	"flag"
+	"fmt"
+	"github.com/pebbe/zmq4"
+)
+
+// Keygen prints a new CurveZMQ keypair, or the public key of an existing
+// secret key, for the curve sections of ReportDB, the backend and the poller:
+//
+//	reportdb keygen [-secret <secret key>]
+func Keygen(args []string) error {
+
+	flags := flag.NewFlagSet("keygen", flag.ContinueOnError)
+
+	secret := flags.String("secret", "", "print the public key of this secret key instead")
+
+	if err := flags.Parse(args); err != nil {
+
+		return err
+	}
+
+	var public string
+
+	var err error
+
+	if *secret != "" {
+
+		public, err = zmq4.AuthCurvePublic(*secret)
+
+	} else {
+
+		public, *secret, err = zmq4.NewCurveKeypair()
+	}
+
+	if err != nil {
+
+		return fmt.Errorf("error generating keys: %v", err)
+	}
+
+	fmt.Printf("public key: %s\nsecret key: %s\n", public, *secret)
+
+	return nil
+}
@@ -0,0 +1,203 @@
+package tools
+
+import (
+	"compress/gzip"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/pebbe/zmq4"
+	"github.com/vmihailenco/msgpack/v5"
+	"io"
+	"math"
+	"os"
+	. "reportdb/utils"
+	"strconv"
+	"time"
+)
+
+// Load replays a dump file into a running instance through its polling
+// socket, so the events take the normal write path. It waits until every
+// batch is acknowledged as stored:
+//
+//	reportdb load -in counter_1.dump [-counter 7] [-endpoint tcp://localhost:6003]
+//
+// -server-key and -secret-key connect through CurveZMQ, with the instance's
+// public key and a secret key whose public key it authorizes.
+func Load(args []string) error {
+
+	flags := flag.NewFlagSet("load", flag.ContinueOnError)
+
+	in := flags.String("in", "", "dump file to read")
+
+	counterID := flags.Uint("counter", 0, "load the events into this counter instead of the dumped one")
+
+	endpoint := flags.String("endpoint", "tcp://localhost:6003", "polling socket of the running instance")
+
+	batchSize := flags.Int("batch", 1000, "events per message")
+
+	timeout := flags.Duration("timeout", 30*time.Second, "longest wait for an acknowledgement")
+
+	serverKey := flags.String("server-key", "", "public CURVE key of the instance")
+
+	secretKey := flags.String("secret-key", "", "secret CURVE key to connect with")
+
+	if err := flags.Parse(args); err != nil {
+
+		return err
+	}
+
+	if *in == "" || *counterID > math.MaxUint16 || *batchSize <= 0 {
+
+		return fmt.Errorf("load needs -in, a valid -counter and a positive -batch")
+	}
+
+	file, err := os.Open(*in)
+
+	if err != nil {
+
+		return fmt.Errorf("error opening %s: %v", *in, err)
+	}
+
+	defer file.Close()
+
+	decompressor, err := gzip.NewReader(file)
+
+	if err != nil {
+
+		return fmt.Errorf("error reading %s: %v", *in, err)
+	}
+
+	decoder := msgpack.NewDecoder(decompressor)
+
+	var header dumpHeader
+
+	if err := decoder.Decode(&header); err != nil {
+
+		return fmt.Errorf("error reading header: %v", err)
+	}
+
+	if header.Version != dumpVersion {
+
+		return fmt.Errorf("unsupported dump version %d", header.Version)
+	}
+
+	target := header.CounterID
+
+	if *counterID != 0 {
+
+		target = uint16(*counterID)
+	}
+
+	dataType, err := GetCounterType(target)
+
+	if err != nil {
+
+		return err
+	}
+
+	if dataType != header.Type {
+
+		return fmt.Errorf("counter %d has type %d but the dump has type %d", target, dataType, header.Type)
+	}
+
+	context, err := zmq4.NewContext()
+
+	if err != nil {
+
+		return fmt.Errorf("failed to create context: %v", err)
+	}
+
+	defer context.Term()
+
+	dealerSocket, err := context.NewSocket(zmq4.DEALER)
+
+	if err != nil {
+
+		return fmt.Errorf("failed to create DEALER socket: %v", err)
+	}
+
+	defer dealerSocket.Close()
+
+	dealerSocket.SetLinger(0) // every batch is acknowledged before closing
+
+	dealerSocket.SetRcvtimeo(*timeout)
+
+	if *serverKey != "" {
+
+		publicKey, err := zmq4.AuthCurvePublic(*secretKey)
+
+		if err == nil {
+
+			err = dealerSocket.ClientAuthCurve(*serverKey, publicKey, *secretKey)
+		}
+
+		if err != nil {
+
+			return fmt.Errorf("invalid -secret-key: %v", err)
+		}
+	}
+
+	if err := dealerSocket.Connect(*endpoint); err != nil {
+
+		return fmt.Errorf("failed to connect to %s: %v", *endpoint, err)
+	}
+
+	total, sent := 0, 0
+
+	session := strconv.FormatInt(time.Now().UnixNano(), 36) // keeps batch IDs apart from other loads
+
+	for {
+
+		var events []Events
+
+		err := decoder.Decode(&events)
+
+		if errors.Is(err, io.EOF) {
+
+			break
+		}
+
+		if err != nil {
+
+			return fmt.Errorf("error reading events: %v", err)
+		}
+
+		for start := 0; start < len(events); start += *batchSize {
+
+			batch := events[start:min(start+*batchSize, len(events))]
+
+			for i := range batch {
+
+				batch[i].CounterId = target
+			}
+
+			data, err := msgpack.Marshal(batch)
+
+			if err != nil {
+
+				return fmt.Errorf("error encoding events: %v", err)
+			}
+
+			if _, err := dealerSocket.SendMessage(fmt.Sprintf("load-%s-%d", session, sent), data); err != nil {
+
+				return fmt.Errorf("error sending events: %v", err)
+			}
+
+			total += len(batch)
+
+			sent++
+		}
+	}
+
+	for acknowledged := 0; acknowledged < sent; acknowledged++ {
+
+		if _, err := dealerSocket.RecvMessageBytes(0); err != nil {
+
+			return fmt.Errorf("%d of %d batches acknowledged: %v", acknowledged, sent, err)
+		}
+	}
+
+	fmt.Printf("loaded %d events into counter %d through %s\n", total, target, *endpoint)
+
+	return nil
+}
@@ -0,0 +1,197 @@
+package utils
+
+import "sort"
+
+// Columns holds decoded points column by column: the timestamps and the values
+// of the counter's type, so numeric samples are never boxed. The value columns
+// of the other types stay empty.
+type Columns struct {
+	Type DataType
+
+	Timestamps []uint32
+
+	Uint64s []uint64
+
+	Float64s []float64
+
+	Strings []string
+}
+
+func NewColumns(dataType DataType, capacity int) Columns {
+
+	columns := Columns{
+
+		Type: dataType,
+
+		Timestamps: make([]uint32, 0, capacity),
+	}
+
+	switch dataType {
+
+	case TypeUint64:
+
+		columns.Uint64s = make([]uint64, 0, capacity)
+
+	case TypeFloat64:
+
+		columns.Float64s = make([]float64, 0, capacity)
+
+	case TypeString:
+
+		columns.Strings = make([]string, 0, capacity)
+	}
+
+	return columns
+}
+
+func (columns *Columns) Len() int {
+
+	return len(columns.Timestamps)
+}
+
+// Append adds a point. It returns false, and adds nothing, when value is not
+// of the columns' type.
+func (columns *Columns) Append(timestamp uint32, value interface{}) bool {
+
+	switch columns.Type {
+
+	case TypeUint64:
+
+		number, ok := value.(uint64)
+
+		if !ok {
+
+			return false
+		}
+
+		columns.Uint64s = append(columns.Uint64s, number)
+
+	case TypeFloat64:
+
+		number, ok := value.(float64)
+
+		if !ok {
+
+			return false
+		}
+
+		columns.Float64s = append(columns.Float64s, number)
+
+	case TypeString:
+
+		text, ok := value.(string)
+
+		if !ok {
+
+			return false
+		}
+
+		columns.Strings = append(columns.Strings, text)
+
+	default:
+
+		return false
+	}
+
+	columns.Timestamps = append(columns.Timestamps, timestamp)
+
+	return true
+}
+
+// AppendRow adds row i of source, which holds the same type.
+func (columns *Columns) AppendRow(source *Columns, i int) {
+
+	columns.Timestamps = append(columns.Timestamps, source.Timestamps[i])
+
+	switch columns.Type {
+
+	case TypeUint64:
+
+		columns.Uint64s = append(columns.Uint64s, source.Uint64s[i])
+
+	case TypeFloat64:
+
+		columns.Float64s = append(columns.Float64s, source.Float64s[i])
+
+	case TypeString:
+
+		columns.Strings = append(columns.Strings, source.Strings[i])
+	}
+}
+
+// Value boxes the value of row i, for building responses.
+func (columns *Columns) Value(i int) interface{} {
+
+	switch columns.Type {
+
+	case TypeUint64:
+
+		return columns.Uint64s[i]
+
+	case TypeFloat64:
+
+		return columns.Float64s[i]
+
+	case TypeString:
+
+		return columns.Strings[i]
+	}
+
+	return nil
+}
+
+// Points boxes every row, for the paths that work on values of any type.
+func (columns *Columns) Points() []DataPoint {
+
+	points := make([]DataPoint, columns.Len())
+
+	for i := range points {
+
+		points[i] = DataPoint{
+
+			Timestamp: columns.Timestamps[i],
+
+			Value: columns.Value(i),
+		}
+	}
+
+	return points
+}
+
+// Sort orders the rows by timestamp, keeping the order of equal timestamps.
+// Rows are usually written in order, so sorted columns are only scanned.
+func (columns *Columns) Sort() {
+
+	sorted := true
+
+	for i := 1; i < len(columns.Timestamps) && sorted; i++ {
+
+		sorted = columns.Timestamps[i-1] <= columns.Timestamps[i]
+	}
+
+	if sorted {
+
+		return
+	}
+
+	order := make([]int, columns.Len())
+
+	for i := range order {
+
+		order[i] = i
+	}
+
+	sort.SliceStable(order, func(a, b int) bool {
+
+		return columns.Timestamps[order[a]] < columns.Timestamps[order[b]]
+	})
+
+	reordered := NewColumns(columns.Type, columns.Len())
+
+	for _, i := range order {
+
+		reordered.AppendRow(columns, i)
+	}
+
+	*columns = reordered
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 	"syscall"
 )
 
@@ -30,6 +31,41 @@ type Config struct {
 	SaveIndexInterval int `json:"saveIndexInterval"`
 
 	QueryTimeout int `json:"queryTimeout"`
+
+	MaxQueryDays int `json:"maxQueryDays"`
+
+	MaxQueryObjects int `json:"maxQueryObjects"`
+
+	MaxQueryCost int `json:"maxQueryCost"`
+
+	MaxQueryPoints int `json:"maxQueryPoints"`
+
+	SlowQueryThreshold int `json:"slowQueryThreshold"`
+
+	StreamQueryDays int `json:"streamQueryDays"`
+
+	FeedBuffer int `json:"feedBuffer"`
+
+	HTTPAddress string `json:"httpAddress"`
+
+	PollingEndpoint string `json:"pollingEndpoint"`
+
+	QueryEndpoint string `json:"queryEndpoint"`
+
+	ResultEndpoint string `json:"resultEndpoint"`
+
+	FeedEndpoint string `json:"feedEndpoint"`
+
+	Curve CurveConfig `json:"curve"`
+}
+
+// CurveConfig enables CurveZMQ on every socket when SecretKey is set. Only
+// clients whose public key is in AuthorizedKeys may connect, any client with
+// "*".
+type CurveConfig struct {
+	SecretKey string `json:"secretKey"`
+
+	AuthorizedKeys []string `json:"authorizedKeys"`
 }
 
 type DataType uint8
@@ -42,6 +78,10 @@ const (
 	TypeString
 )
 
+// MaxStringLength is the longest string value, in bytes, a record can hold.
+// With its 8 byte header it fills the 100 byte buffer of a writer.
+const MaxStringLength = 92
+
 type CounterConfig struct {
 	Name string `json:"name"`
 
@@ -53,6 +93,10 @@ var (
 
 	counterTypes = map[uint16]DataType{}
 
+	counterNames = map[string]uint16{} // names of the counters in counter.json
+
+	counterLock sync.RWMutex // counters derived by continuous queries are registered at runtime
+
 	workingDir string
 )
 
@@ -67,6 +111,21 @@ func InitConfig() error {
 
 	workingDir = filepath.Dir(currentPath) // ./reportdb
 
+	appConfig = Config{ // settings missing from config.json keep these defaults
+
+		StreamQueryDays: 7,
+
+		FeedBuffer: 10000,
+
+		PollingEndpoint: "tcp://*:6003",
+
+		QueryEndpoint: "tcp://*:6004",
+
+		ResultEndpoint: "tcp://*:6005",
+
+		FeedEndpoint: "tcp://*:6006",
+	}
+
 	configPath := workingDir + "/config/config.json"
 
 	configData, err := os.ReadFile(configPath)
@@ -81,6 +140,11 @@ func InitConfig() error {
 		return fmt.Errorf("parse timer.json file error: %s", err)
 	}
 
+	if appConfig.FeedBuffer <= 0 { // 0 would make the feed socket buffer without limit
+
+		return fmt.Errorf("feedBuffer must be positive, got %d", appConfig.FeedBuffer)
+	}
+
 	counterPath := workingDir + "/config/counter.json"
 
 	counterData, err := os.ReadFile(counterPath)
@@ -99,6 +163,11 @@ func InitConfig() error {
 
 	for key, value := range tempCounterMapping {
 
+		if value.Name != "" {
+
+			counterNames[value.Name] = key
+		}
+
 		switch value.Type {
 
 		case "uint64":
@@ -179,8 +248,12 @@ func GetSaveIndexInterval() int {
 
 func GetCounterType(counterId uint16) (DataType, error) {
 
+	counterLock.RLock()
+
 	dataType, ok := counterTypes[counterId]
 
+	counterLock.RUnlock()
+
 	if !ok {
 
 		return 0, fmt.Errorf("counter ID %d not found", counterId)
@@ -191,7 +264,47 @@ func GetCounterType(counterId uint16) (DataType, error) {
 
 func GetAllCounterTypes() map[uint16]DataType {
 
-	return counterTypes
+	counterLock.RLock()
+
+	defer counterLock.RUnlock()
+
+	types := make(map[uint16]DataType, len(counterTypes))
+
+	for counterId, dataType := range counterTypes {
+
+		types[counterId] = dataType
+	}
+
+	return types
+}
+
+// GetCounterID returns the ID of the counter named name in counter.json.
+func GetCounterID(name string) (uint16, bool) {
+
+	counterLock.RLock()
+
+	defer counterLock.RUnlock()
+
+	counterId, ok := counterNames[name]
+
+	return counterId, ok
+}
+
+// RegisterCounterType adds a counter that is not in counter.json.
+func RegisterCounterType(counterId uint16, dataType DataType) error {
+
+	counterLock.Lock()
+
+	defer counterLock.Unlock()
+
+	if existing, ok := counterTypes[counterId]; ok && existing != dataType {
+
+		return fmt.Errorf("counter ID %d already exists with another type", counterId)
+	}
+
+	counterTypes[counterId] = dataType
+
+	return nil
 }
 
 func GetQueryTimeout() int {
@@ -199,6 +312,79 @@ func GetQueryTimeout() int {
 	return appConfig.QueryTimeout
 }
 
+// The query limits below are disabled when set to 0.
+
+func GetMaxQueryDays() int {
+
+	return appConfig.MaxQueryDays
+}
+
+func GetMaxQueryObjects() int {
+
+	return appConfig.MaxQueryObjects
+}
+
+func GetMaxQueryCost() int {
+
+	return appConfig.MaxQueryCost
+}
+
+func GetMaxQueryPoints() int {
+
+	return appConfig.MaxQueryPoints
+}
+
+func GetSlowQueryThreshold() int {
+
+	return appConfig.SlowQueryThreshold
+}
+
+// GetStreamQueryDays returns from how many days on numeric aggregations are
+// computed while reading, 0 never.
+func GetStreamQueryDays() int {
+
+	return appConfig.StreamQueryDays
+}
+
+// GetFeedBuffer returns how many events a feed subscriber may fall behind
+// before events are dropped for it.
+func GetFeedBuffer() int {
+
+	return appConfig.FeedBuffer
+}
+
+// GetHTTPAddress returns the address the HTTP API listens on, empty when it
+// is disabled.
+func GetHTTPAddress() string {
+
+	return appConfig.HTTPAddress
+}
+
+func GetPollingEndpoint() string {
+
+	return appConfig.PollingEndpoint
+}
+
+func GetQueryEndpoint() string {
+
+	return appConfig.QueryEndpoint
+}
+
+func GetResultEndpoint() string {
+
+	return appConfig.ResultEndpoint
+}
+
+func GetFeedEndpoint() string {
+
+	return appConfig.FeedEndpoint
+}
+
+func GetCurve() CurveConfig {
+
+	return appConfig.Curve
+}
+
 func SysTotalMemory() uint64 {
 
 	in := &syscall.Sysinfo_t{}
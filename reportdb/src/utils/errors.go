@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	ErrInvalidQuery = "INVALID_QUERY"
+
+	ErrQueryTooLarge = "QUERY_TOO_LARGE"
+
+	ErrQueryTimeout = "QUERY_TIMEOUT"
+
+	ErrNoData = "NO_DATA"
+
+	ErrInternal = "INTERNAL_ERROR"
+)
+
+// QueryError is an error with a stable code that is sent to clients in
+// Response.Code next to the human readable Response.Error.
+type QueryError struct {
+	Code string
+
+	Message string
+}
+
+func (err *QueryError) Error() string {
+
+	return err.Message
+}
+
+func NewQueryError(code string, format string, args ...interface{}) *QueryError {
+
+	return &QueryError{
+
+		Code: code,
+
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+func GetErrorCode(err error) string {
+
+	var queryError *QueryError
+
+	if errors.As(err, &queryError) {
+
+		return queryError.Code
+	}
+
+	return ErrInternal
+}
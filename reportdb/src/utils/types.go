@@ -10,6 +10,18 @@ type Events struct {
 	Value interface{} `msgpack:"value" json:"value"`
 }
 
+// Batch is a batch of events whose sender waits for an acknowledgement.
+// Once the writers have handled every event, Stored is called when each was
+// stored or rejected for good, and Failed otherwise with the indexes of the
+// events the store failed, which a retransmission may still store.
+type Batch struct {
+	Events []Events
+
+	Stored func()
+
+	Failed func(failed []int)
+}
+
 type DataPoint struct {
 	Timestamp uint32 `json:"timestamp"`
 
@@ -20,11 +32,45 @@ type QueryReceive struct {
 	RequestID uint64 `msgpack:"request_id" json:"request_id"`
 
 	Query Query `msgpack:"query_request" json:"query_request"`
+
+	Admin *AdminCommand `msgpack:"admin,omitempty" json:"admin,omitempty"` // set instead of Query for admin requests
+
+	// internal queries get their response here instead of on the response
+	// socket. It runs on the reader, before the reader reuses its buffers.
+	Reply func(Response) `msgpack:"-" json:"-"`
+}
+
+type AdminCommand struct {
+	Action string `msgpack:"action" json:"action"` // create_cq, list_cq or delete_cq
+
+	ContinuousQuery *ContinuousQuery `msgpack:"continuous_query,omitempty" json:"continuous_query,omitempty"`
+
+	Name string `msgpack:"name,omitempty" json:"name,omitempty"`
+}
+
+// ContinuousQuery runs Query over every window of Every seconds and writes the
+// result to TargetCounterID.
+type ContinuousQuery struct {
+	Name string `msgpack:"name" json:"name"`
+
+	Query Query `msgpack:"query" json:"query"` // From and To are set for every window
+
+	Every int `msgpack:"every" json:"every"`
+
+	Delay int `msgpack:"delay" json:"delay"` // seconds to wait after a window ends for late data
+
+	TargetCounterID uint16 `msgpack:"target_counter_id" json:"target_counter_id"`
+
+	TargetObjectID uint32 `msgpack:"target_object_id" json:"target_object_id"` // object of results merged over all objects
+
+	LastRun uint32 `msgpack:"last_run" json:"last_run"` // end of the last materialised window
 }
 
 type Query struct {
 	CounterID uint16 `msgpack:"counter_id" json:"counter_id"`
 
+	CounterIDs []uint16 `msgpack:"counter_ids" json:"counter_ids"` // counters of latest queries, CounterID when empty
+
 	ObjectIDs []uint32 `msgpack:"object_ids" json:"object_ids"`
 
 	From uint32 `msgpack:"from" json:"from"`
@@ -36,6 +82,95 @@ type Query struct {
 	GroupByObjects bool `msgpack:"group_by_objects" json:"group_by_objects"`
 
 	Interval int `msgpack:"interval" json:"interval"`
+
+	Fill string `msgpack:"fill" json:"fill"` // null, zero, previous, linear or a constant
+
+	MergeEmpty bool `msgpack:"merge_empty" json:"merge_empty"` // let filled empty buckets take part in cross-object merges
+
+	CalendarInterval string `msgpack:"calendar_interval" json:"calendar_interval"` // 1d, 1w, 1M, used instead of Interval
+
+	Timezone string `msgpack:"timezone" json:"timezone"` // IANA name used to align buckets, UTC when empty
+
+	Explain bool `msgpack:"explain" json:"explain"` // return QueryStats in Response.Stats
+
+	Priority string `msgpack:"priority" json:"priority"` // interactive (default) or bulk
+
+	Type string `msgpack:"type" json:"type"` // empty for gauge, grid and histogram queries, raw, baseline, forecast, heatmap or latest
+
+	Format string `msgpack:"format" json:"format"` // json, csv or ndjson for raw queries
+
+	Limit int `msgpack:"limit" json:"limit"` // page size of raw queries
+
+	Offset int `msgpack:"offset" json:"offset"` // first row of the page of raw queries
+
+	MaxPoints int `msgpack:"max_points" json:"max_points"` // points kept per series of raw queries and histograms, all when 0
+
+	Downsample string `msgpack:"downsample" json:"downsample"` // lttb (default) or minmax, how series are cut to MaxPoints
+
+	Baseline *BaselineOptions `msgpack:"baseline,omitempty" json:"baseline,omitempty"`
+
+	Forecast *ForecastOptions `msgpack:"forecast,omitempty" json:"forecast,omitempty"`
+
+	Heatmap *HeatmapOptions `msgpack:"heatmap,omitempty" json:"heatmap,omitempty"`
+
+	Window *WindowOptions `msgpack:"window,omitempty" json:"window,omitempty"` // smooths every object after bucketing
+
+	Offsets []int `msgpack:"offsets,omitempty" json:"offsets,omitempty"` // seconds to shift the range back by, results are returned side by side
+}
+
+// BaselineOptions configure the band of baseline queries. Zero values take
+// the defaults.
+type BaselineOptions struct {
+	Method string `msgpack:"method" json:"method"` // stddev (default) or seasonal
+
+	K float64 `msgpack:"k" json:"k"` // half width of the band in standard deviations, 3 by default
+
+	Window int `msgpack:"window" json:"window"` // buckets before each bucket the stddev band is computed over, 12 by default
+
+	Season int `msgpack:"season" json:"season"` // seconds between seasonal samples, a week by default
+
+	Seasons int `msgpack:"seasons" json:"seasons"` // seasonal samples per bucket, 4 by default
+}
+
+// ForecastOptions configure forecast queries. Zero values take the defaults.
+type ForecastOptions struct {
+	Model string `msgpack:"model" json:"model"` // linear (default) or holt_winters
+
+	Lookback int `msgpack:"lookback" json:"lookback"` // seconds before To to fit over, the query range when 0
+
+	Horizon int `msgpack:"horizon" json:"horizon"` // seconds after To to project, a day by default
+
+	Threshold *float64 `msgpack:"threshold,omitempty" json:"threshold,omitempty"` // value whose crossing time is estimated
+
+	Season int `msgpack:"season" json:"season"` // buckets per season for holt_winters, 24 by default
+
+	Alpha float64 `msgpack:"alpha" json:"alpha"` // holt_winters smoothing of the level, 0.3 by default
+
+	Beta float64 `msgpack:"beta" json:"beta"` // of the trend, 0.1 by default
+
+	Gamma float64 `msgpack:"gamma" json:"gamma"` // of the seasonal component, 0.1 by default
+}
+
+// HeatmapOptions configure the value bins of heatmap queries. Zero values
+// take the defaults.
+type HeatmapOptions struct {
+	Scale string `msgpack:"scale" json:"scale"` // linear (default) or exponential
+
+	Bins int `msgpack:"bins" json:"bins"` // value bins, 10 by default
+
+	Min float64 `msgpack:"min" json:"min"` // lower edge of the first bin, the lowest value when min and max are 0
+
+	Max float64 `msgpack:"max" json:"max"` // upper edge of the last bin, the highest value when min and max are 0
+}
+
+// WindowOptions configure the window function histograms apply to the
+// buckets of every object. Zero values take the defaults.
+type WindowOptions struct {
+	Function string `msgpack:"function" json:"function"` // moving_avg, moving_sum, ewma or cumsum
+
+	Size int `msgpack:"size" json:"size"` // buckets of moving windows, the current one included, 5 by default
+
+	Alpha float64 `msgpack:"alpha" json:"alpha"` // ewma weight of the current bucket, 0.3 by default
 }
 
 type Response struct {
@@ -43,5 +178,50 @@ type Response struct {
 
 	Error string `msgpack:"error,omitempty" json:"error,omitempty"`
 
+	Code string `msgpack:"code,omitempty" json:"code,omitempty"`
+
 	Data interface{} `msgpack:"data" json:"data"`
+
+	Stats *QueryStats `msgpack:"stats,omitempty" json:"stats,omitempty"`
+}
+
+// QueryStats describes how a query was executed. Object workers update it
+// concurrently through sync/atomic. Times are in nanoseconds, the index load
+// and scan times are summed over all object workers.
+type QueryStats struct {
+	Days int64 `msgpack:"days" json:"days"`
+
+	EnginesOpened int64 `msgpack:"engines_opened" json:"engines_opened"`
+
+	Objects int64 `msgpack:"objects" json:"objects"`
+
+	IndexEntries int64 `msgpack:"index_entries" json:"index_entries"`
+
+	BytesScanned int64 `msgpack:"bytes_scanned" json:"bytes_scanned"`
+
+	RecordsScanned int64 `msgpack:"records_scanned" json:"records_scanned"`
+
+	RecordsDecoded int64 `msgpack:"records_decoded" json:"records_decoded"`
+
+	CacheHits int64 `msgpack:"cache_hits" json:"cache_hits"`
+
+	CacheMisses int64 `msgpack:"cache_misses" json:"cache_misses"`
+
+	Points int64 `msgpack:"points" json:"points"`
+
+	Streamed bool `msgpack:"streamed" json:"streamed"` // aggregated while reading, without loading the points
+
+	IndexLoadTime int64 `msgpack:"index_load_ns" json:"index_load_ns"`
+
+	ScanTime int64 `msgpack:"scan_ns" json:"scan_ns"`
+
+	PlanTime int64 `msgpack:"plan_ns" json:"plan_ns"`
+
+	FetchTime int64 `msgpack:"fetch_ns" json:"fetch_ns"`
+
+	MergeTime int64 `msgpack:"merge_ns" json:"merge_ns"`
+
+	ParseTime int64 `msgpack:"parse_ns" json:"parse_ns"`
+
+	TotalTime int64 `msgpack:"total_ns" json:"total_ns"`
 }